@@ -2,4 +2,7 @@ module github.com/pltanton/autobrowser/common
 
 go 1.22.1
 
-require github.com/BurntSushi/toml v1.5.0
+require (
+	github.com/BurntSushi/toml v1.5.0
+	golang.org/x/net v0.35.0
+)
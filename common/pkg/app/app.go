@@ -1,105 +1,508 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
 	"os"
-	"os/exec"
-	"strings"
+	"slices"
 
+	"github.com/pltanton/autobrowser/common/pkg/choicestore"
+	"github.com/pltanton/autobrowser/common/pkg/cmdtemplate"
 	"github.com/pltanton/autobrowser/common/pkg/configuration"
 	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/notify"
 )
 
-func SetupAndRun(configPath string, urlString string, r *matchers.MatchersRegistry) {
-	c, err := configuration.ParseConfigFile(configPath)
+func SetupAndRun(configPath string, urlString string, r *matchers.MatchersRegistry, n notify.Notifier) {
+	c, err := loadConfig(configPath, r)
 	if err != nil {
 		slog.Error("Failed to parse cofig file", "path", configPath, "err", err)
+		notifyConfigError(n, configPath, err)
 		os.Exit(1)
 	}
 
-	err = evaluate(c, r, urlString)
+	decision, err := openURL(c, r, &notifier{n: n, config: c.Notify}, urlString)
+	if status := exitStatus(decision, err); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// openURL evaluates the rules and launches the decided command, failures and
+// the decision are notified as configured
+func openURL(c *configuration.Config, r *matchers.MatchersRegistry, n *notifier, urlString string) (*Decision, error) {
+	decision, err := evaluate(c, r, urlString)
 	if err != nil {
 		slog.Error("Failed to evaluate", "err", err)
-		os.Exit(1)
+		n.failure("Failed to route URL", urlString, err)
+		return decision, err
+	}
+
+	launched, err := launchDecision(c, r, n, decision)
+	if err != nil || launched == nil {
+		return decision, err
+	}
+
+	n.decision(c, r, decision, *launched)
+	return decision, nil
+}
+
+// launchDecision asks for the command if the decision has choices and
+// launches it, launched is nil when nothing is chosen
+func launchDecision(c *configuration.Config, fields fieldResolver, n *notifier, decision *Decision) (*Launch, error) {
+	if decision.Choices != nil {
+		if err := ask(c, fields, decision); err != nil {
+			slog.Error("Failed to ask for command", "err", err)
+			n.failure("Failed to ask for browser", decision.URL, err)
+			return nil, err
+		}
+		if decision.Argv == nil {
+			slog.Info("Nothing chosen, URL is not opened")
+			return nil, nil
+		}
+	}
+
+	launched, err := launchAll(decision)
+	if err != nil {
+		slog.Error("Failed to run command", "err", err)
+		n.failure("Failed to open URL", decisionURL(decision), err)
+		return nil, err
+	}
+
+	return &launched, nil
+}
+
+// exitProviderError is the exit status when the URL is opened, but providers
+// failed and the decision could be wrong
+const exitProviderError = 2
+
+// exitStatus returns exit status of opening the URL
+func exitStatus(d *Decision, err error) int {
+	switch {
+	case err != nil:
+		return 1
+	case len(d.ProviderErrors) > 0:
+		return exitProviderError
+	default:
+		return 0
+	}
+}
+
+// loadConfig parses the config file and compiles its matchers
+func loadConfig(configPath string, r *matchers.MatchersRegistry) (*configuration.Config, error) {
+	c, err := configuration.ParseConfigFile(configPath)
+	if err != nil {
+		return nil, err
 	}
+
+	if err := c.Compile(r); err != nil {
+		return nil, err
+	}
+
+	return c, nil
 }
 
-func evaluate(c *configuration.Config, r *matchers.MatchersRegistry, urlString string) error {
-	var command configuration.Command
-	var matched bool
+// evaluate walks through the rules and decides which command should open the
+// URL. On error the returned decision contains the trace collected so far.
+func evaluate(c *configuration.Config, r *matchers.MatchersRegistry, urlString string) (*Decision, error) {
+	decision := &Decision{
+		URL:         urlString,
+		MatchedRule: -1,
+	}
+
+	target, unwrapped := c.Unwrapper.Unwrap(urlString)
+	if len(unwrapped) > 0 {
+		slog.Debug("URL unwrapped", "url", target, "wrappers", unwrapped)
+		decision.Unwrapped = unwrapped
+	}
+
+	target, decision.Rewrites = c.Rewriter.Rewrite(target)
+	if len(decision.Rewrites) > 0 {
+		slog.Debug("URL rewritten", "url", target, "rewrites", decision.Rewrites)
+	}
+
+	req := matchers.NewRequest(urlString)
+	if target != urlString {
+		decision.TargetURL = target
+		req = req.WithURL(target)
+	}
+
+	decision.req = req
+	if c.Sticky.Enabled && c.Sticky.Stage == choicestore.StageBeforeRules && useStickyChoice(c, decision) {
+		return decision, resolveCommand(c, r, decision)
+	}
 
+	e := &evaluator{req: req, policy: c.OnProviderError}
 	for ruleN, rule := range c.Rules {
-		allMatched := true
-		for matcherN, matcherConfig := range rule.Matchers {
-			logWithMatcher := slog.With("type", matcherConfig.Type, "rule id", ruleN, "matcher id", matcherN)
-			logWithMatcher.Debug("Start matching")
-
-			matcher, err := r.GetMatcher(matcherConfig.Type)
-			if err != nil {
-				return err
-			}
+		logWithRule := slog.With("rule id", ruleN)
 
-			ok, err := matcher.Match(c.ConfigProvider(matcherConfig))
-			if err != nil {
-				return err
-			}
+		ok, traces, err := e.matchAll(rule.Matchers, logWithRule)
+		ruleTrace := RuleTrace{
+			Rule:     ruleN,
+			Command:  rule.Command,
+			Matched:  ok,
+			Matchers: traces,
+		}
 
-			logWithMatcher.Debug("Matcher match result", "matched", ok)
-			if !ok {
-				allMatched = false
-				break
+		var providerErr *matchers.ProviderError
+		if errors.As(err, &providerErr) {
+			e.addProviderError(err)
+			ruleTrace.Error = err.Error()
+
+			if c.OnProviderError == configuration.ProviderErrorFailRule {
+				logWithRule.Error("Provider failed, skipping the rule", "err", err)
+				decision.Rules = append(decision.Rules, ruleTrace)
+				continue
 			}
 		}
 
-		if !allMatched {
-			continue
+		decision.Rules = append(decision.Rules, ruleTrace)
+		if err != nil {
+			decision.ProviderErrors = e.providerErrors
+			if providerErr == nil || c.FallbackCommand == "" {
+				return decision, err
+			}
+
+			slog.Error("Provider failed, using fallback command", "err", err)
+			decision.Fallback = true
+			decision.Command = c.FallbackCommand
+			break
 		}
 
-		matched = true
-		var ok bool
-		command, ok = c.Commands[rule.Command]
 		if !ok {
-			slog.Debug("Command not declared, using command as is", "command", rule.Command)
-			command = configuration.NewDefaultCommand(rule.Command)
+			continue
 		}
 
+		decision.MatchedRule = ruleN
+		decision.Command = rule.Command
 		break
 	}
+	decision.ProviderErrors = e.providerErrors
 
-	if !matched {
+	switch {
+	case decision.MatchedRule != -1 || decision.Fallback:
+	case c.Sticky.Enabled && c.Sticky.Stage == choicestore.StageAfterRules && useStickyChoice(c, decision):
+	default:
 		slog.Debug("None of matchers matched, using default command")
-		var ok bool
-		command, ok = c.Commands[c.DefaultCommand]
+		decision.Command = c.DefaultCommand
+	}
+
+	return decision, resolveCommand(c, r, decision)
+}
+
+// resolveCommand builds argv of the decided command. Ask command is resolved
+// to the choice remembered for the host, otherwise argv is left empty and the
+// user should be asked.
+func resolveCommand(c *configuration.Config, fields fieldResolver, d *Decision) error {
+	req := d.req
+
+	command := lookupCommand(c, d.Command)
+	if command.Type == configuration.CommandAsk {
+		if len(command.Choices) == 0 {
+			return fmt.Errorf("ask command %s has no choices", d.Command)
+		}
+
+		d.AskCommand = d.Command
+		entry, ok := rememberedChoice(c, req.URL.Hostname(), func(choice string) bool {
+			return command.Remember && slices.Contains(command.Choices, choice)
+		})
 		if !ok {
-			slog.Debug("Default command not declared, using command as is", "command", c.DefaultCommand)
-			command = configuration.NewDefaultCommand(c.DefaultCommand)
+			d.Choices = command.Choices
+			return nil
 		}
+
+		d.Command = entry.Command
+		d.Remembered = entry.Key
+		command = lookupCommand(c, entry.Command)
+	}
+
+	req, removed := cleanRequest(c, command, req)
+	if len(removed) > 0 {
+		slog.Debug("Tracking parameters removed", "url", req.RawURL, "params", removed)
+		d.RemovedParams = removed
+		d.TargetURL = req.RawURL
 	}
 
-	return runCommand(command, urlString)
+	launch, err := buildLaunch(c, fields, d.Command, command, req)
+	if err != nil {
+		return err
+	}
+	d.Argv, d.Wait, d.Timeout = launch.Argv, launch.Wait, launch.Timeout
+
+	d.Fallbacks, err = buildFallbacks(c, fields, d, command.Fallback)
+	if err != nil {
+		return err
+	}
+
+	// Detached commands failing right away, e.g. on a locked profile, are
+	// noticed only when watched, so they are watched when a fallback follows
+	if len(d.Fallbacks) > 0 && !d.Wait && d.Timeout == 0 {
+		d.Timeout = defaultLaunchWatch
+	}
+	for i := 0; i < len(d.Fallbacks)-1; i++ {
+		if !d.Fallbacks[i].Wait && d.Fallbacks[i].Timeout == 0 {
+			d.Fallbacks[i].Timeout = defaultLaunchWatch
+		}
+	}
+	return nil
 }
 
-func runCommand(cmdConfig configuration.Command, urlString string) error {
-	cmd := cmdConfig.CMD[:]
+// buildFallbacks builds launches of the fallback commands of the matched rule
+// or the command, followed by default_command
+func buildFallbacks(c *configuration.Config, fields fieldResolver, d *Decision, fallback []string) ([]Launch, error) {
+	if d.MatchedRule != -1 && c.Rules[d.MatchedRule].Fallback != nil {
+		fallback = c.Rules[d.MatchedRule].Fallback
+	}
 
-	if cmdConfig.QueryEscape {
-		urlString = url.QueryEscape(urlString)
+	var launches []Launch
+	for _, name := range append(slices.Clone(fallback), c.DefaultCommand) {
+		if name == "" || name == d.Command || slices.ContainsFunc(launches, func(l Launch) bool { return l.Command == name }) {
+			continue
+		}
+
+		command := lookupCommand(c, name)
+		if command.Type == configuration.CommandAsk {
+			slog.Debug("Ask command can't be a fallback, skipping it", "command", name)
+			continue
+		}
+
+		req, _ := cleanRequest(c, command, d.req)
+		launch, err := buildLaunch(c, fields, name, command, req)
+		if err != nil {
+			return nil, err
+		}
+		launches = append(launches, launch)
 	}
 
-	for i := range cmd {
-		cmd[i] = strings.Replace(cmd[i], cmdConfig.Placeholder, urlString, 1)
+	return launches, nil
+}
+
+// cleanRequest removes tracking parameters from the URL if the command cleans
+// URLs, it returns names of removed parameters
+func cleanRequest(c *configuration.Config, command configuration.Command, req *matchers.Request) (*matchers.Request, []string) {
+	if !c.ShouldClean(command) {
+		return req, nil
 	}
 
-	slog.Debug("Launching CMD", "command", cmd)
+	cleaned, removed := c.Cleaner.Clean(req.RawURL)
+	if len(removed) == 0 {
+		return req, nil
+	}
+	return req.WithURL(cleaned), removed
+}
 
-	out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+func buildLaunch(c *configuration.Config, fields fieldResolver, name string, command configuration.Command, req *matchers.Request) (Launch, error) {
+	argv, err := buildArgv(command, req, fields)
 	if err != nil {
-		slog.Error("Failed to run command", "err", err, "output", string(out))
-		return fmt.Errorf("failed to execute command: %w", err)
+		return Launch{}, err
 	}
 
-	slog.Debug("Command executed successfully", "output", string(out))
-	return nil
+	if c.SystemdScope || command.SystemdScope {
+		argv = append(slices.Clone(systemdScopeArgv), argv...)
+	}
+
+	return Launch{
+		Command: name,
+		Argv:    argv,
+		Wait:    command.Wait,
+		Timeout: command.LaunchTimeout,
+	}, nil
+}
+
+func lookupCommand(c *configuration.Config, name string) configuration.Command {
+	command, ok := c.Commands[name]
+	if !ok {
+		slog.Debug("Command not declared, using command as is", "command", name)
+		command = configuration.NewDefaultCommand(name)
+	}
+	return command
+}
+
+// evaluator evaluates matchers against the request and collects provider
+// errors tolerated by the policy
+type evaluator struct {
+	req    *matchers.Request
+	policy configuration.ProviderErrorPolicy
+
+	providerErrors []string
+}
+
+func (e *evaluator) addProviderError(err error) {
+	if !slices.Contains(e.providerErrors, err.Error()) {
+		e.providerErrors = append(e.providerErrors, err.Error())
+	}
+}
+
+// matchAll reports whether every matcher matched, stops on the first miss
+func (e *evaluator) matchAll(ms []configuration.TypedMatcher, log *slog.Logger) (bool, []MatcherTrace, error) {
+	traces := make([]MatcherTrace, 0, len(ms))
+	for matcherN, matcherConfig := range ms {
+		trace, err := e.match(matcherConfig, log.With("type", matcherConfig.Type, "matcher id", matcherN))
+		traces = append(traces, trace)
+		if err != nil || !trace.Matched {
+			return false, traces, err
+		}
+	}
+
+	return true, traces, nil
+}
+
+// matchAny reports whether at least one matcher matched, stops on the first hit
+func (e *evaluator) matchAny(ms []configuration.TypedMatcher, log *slog.Logger) (bool, []MatcherTrace, error) {
+	traces := make([]MatcherTrace, 0, len(ms))
+	for matcherN, matcherConfig := range ms {
+		trace, err := e.match(matcherConfig, log.With("type", matcherConfig.Type, "matcher id", matcherN))
+		traces = append(traces, trace)
+		if err != nil || trace.Matched {
+			return trace.Matched, traces, err
+		}
+	}
+
+	return false, traces, nil
+}
+
+func (e *evaluator) match(matcherConfig configuration.TypedMatcher, log *slog.Logger) (MatcherTrace, error) {
+	log.Debug("Start matching")
+
+	trace := MatcherTrace{Type: matcherConfig.Type}
+
+	var err error
+	// Unknown results of failed providers stay unknown through composites,
+	// so negation does not turn them into matches
+	switch matcherConfig.Type {
+	case configuration.MatcherAll:
+		trace.Matched, trace.Matchers, err = e.matchAll(matcherConfig.Matchers, log)
+		trace.Unknown = !trace.Matched && lastUnknown(trace.Matchers)
+	case configuration.MatcherAny:
+		trace.Matched, trace.Matchers, err = e.matchAny(matcherConfig.Matchers, log)
+		trace.Unknown = !trace.Matched && slices.ContainsFunc(trace.Matchers, func(t MatcherTrace) bool { return t.Unknown })
+	case configuration.MatcherNot:
+		var matched bool
+		matched, trace.Matchers, err = e.matchAll(matcherConfig.Matchers, log)
+		trace.Unknown = !matched && lastUnknown(trace.Matchers)
+		trace.Matched = !matched && !trace.Unknown
+	default:
+		if matcherConfig.Matcher == nil {
+			err = fmt.Errorf("%s matcher is not compiled", matcherConfig.Type)
+		} else {
+			trace.Matched, err = matcherConfig.Matcher.Match(e.req)
+		}
+	}
+
+	if err != nil {
+		trace.Matched = false
+		trace.Error = err.Error()
+
+		var providerErr *matchers.ProviderError
+		if e.policy == configuration.ProviderErrorNoMatch && errors.As(err, &providerErr) {
+			log.Error("Provider failed, treating matcher as not matched", "err", err)
+			e.addProviderError(err)
+			trace.Unknown = true
+			return trace, nil
+		}
+		return trace, err
+	}
+
+	log.Debug("Matcher match result", "matched", trace.Matched)
+	return trace, nil
+}
+
+// lastUnknown reports whether the last evaluated matcher is unknown, all
+// stops on the first matcher not matched
+func lastUnknown(traces []MatcherTrace) bool {
+	return len(traces) > 0 && traces[len(traces)-1].Unknown
+}
+
+// fieldResolver resolves template fields provided by matchers, it is
+// implemented by the registry and by fieldSnapshot
+type fieldResolver interface {
+	Field(key string) (string, bool)
+	HasField(key string) bool
+}
+
+// fieldSnapshot keeps values of matcher fields, so commands could be resolved
+// after the request context of matchers is reset by another request
+type fieldSnapshot map[string]string
+
+// snapshotFields resolves matcher fields referenced by commands, which could
+// be resolved after the evaluation: the ask command with its choices, the
+// fallbacks and default_command. Other fields are not resolved, since
+// resolving could query the desktop environment.
+func snapshotFields(c *configuration.Config, r *matchers.MatchersRegistry, d *Decision) fieldSnapshot {
+	names := []string{c.DefaultCommand}
+	if d.Choices != nil {
+		askCommand := c.Commands[d.AskCommand]
+		names = append(names, d.AskCommand, askCommand.Default)
+		names = append(names, askCommand.Choices...)
+		if d.MatchedRule != -1 {
+			names = append(names, c.Rules[d.MatchedRule].Fallback...)
+		}
+	}
+	for _, name := range slices.Clone(names) {
+		names = append(names, c.Commands[name].Fallback...)
+	}
+
+	fields := fieldSnapshot{}
+	isField := configuration.TemplateField(r.HasField)
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		command := lookupCommand(c, name)
+		for _, arg := range command.CMD {
+			for _, key := range cmdtemplate.Parse(arg, command.Placeholder, isField).Fields() {
+				if _, ok := fields[key]; ok || !r.HasField(key) {
+					continue
+				}
+				if value, ok := r.Field(key); ok {
+					fields[key] = value
+				}
+			}
+		}
+	}
+	return fields
+}
+
+func (s fieldSnapshot) Field(key string) (string, bool) {
+	value, ok := s[key]
+	return value, ok
+}
+
+func (s fieldSnapshot) HasField(key string) bool {
+	_, ok := s[key]
+	return ok
+}
+
+// buildArgv expands templates of the command arguments, matcher factories
+// provide fields of the request context like {app.class}
+func buildArgv(cmdConfig configuration.Command, req *matchers.Request, fields fieldResolver) ([]string, error) {
+	cmd := make([]string, len(cmdConfig.CMD))
+
+	urlString := req.RawURL
+	if cmdConfig.QueryEscape {
+		urlString = url.QueryEscape(urlString)
+	}
+
+	urlFields := cmdtemplate.URLFields(req.RawURL, req.URL)
+	resolve := func(name string) (string, bool) {
+		if name == cmdtemplate.OriginalURLField {
+			return req.OriginalRawURL, true
+		}
+		if value, ok := urlFields(name); ok {
+			return value, true
+		}
+		return fields.Field(name)
+	}
+
+	isField := configuration.TemplateField(fields.HasField)
+	for i, arg := range cmdConfig.CMD {
+		var err error
+		if cmd[i], err = cmdtemplate.Parse(arg, cmdConfig.Placeholder, isField).Expand(urlString, resolve); err != nil {
+			return nil, err
+		}
+	}
+
+	return cmd, nil
 }
@@ -0,0 +1,633 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+var errFake = errors.New("fake matcher failure")
+
+// fakeMatcherFactory compiles matchers returning the configured result, every
+// evaluated matcher id is recorded
+type fakeMatcherFactory struct {
+	calls []string
+}
+
+type fakeMatcherConfig struct {
+	ID     string `toml:"id"`
+	Result bool   `toml:"result"`
+	Fail   bool   `toml:"fail"`
+	// ProviderFail fails the matcher with provider error
+	ProviderFail bool `toml:"provider_fail"`
+}
+
+type fakeMatcher struct {
+	config  fakeMatcherConfig
+	factory *fakeMatcherFactory
+}
+
+func (f *fakeMatcherFactory) Compile(configProvider matchers.MatcherConfigProvider) (matchers.Matcher, error) {
+	m := &fakeMatcher{factory: f}
+	if err := configProvider(&m.config); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *fakeMatcher) Match(*matchers.Request) (bool, error) {
+	m.factory.calls = append(m.factory.calls, m.config.ID)
+	if m.config.Fail {
+		return false, errFake
+	}
+	if m.config.ProviderFail {
+		return false, &matchers.ProviderError{Provider: "fake", Err: errFake}
+	}
+	return m.config.Result, nil
+}
+
+func TestMatchComposite(t *testing.T) {
+	tests := []struct {
+		name      string
+		matchers  string
+		want      bool
+		wantErr   error
+		wantCalls []string
+	}{
+		{
+			name:      "implicit and",
+			matchers:  `{type = "fake", id = "a", result = true}, {type = "fake", id = "b", result = true}`,
+			want:      true,
+			wantCalls: []string{"a", "b"},
+		},
+		{
+			name:      "implicit and short-circuits on miss",
+			matchers:  `{type = "fake", id = "a", result = false}, {type = "fake", id = "b", result = true}`,
+			want:      false,
+			wantCalls: []string{"a"},
+		},
+		{
+			name:      "any short-circuits on hit",
+			matchers:  `{type = "any", matchers = [{type = "fake", id = "a", result = true}, {type = "fake", id = "b", fail = true}]}`,
+			want:      true,
+			wantCalls: []string{"a"},
+		},
+		{
+			name:      "any without hits",
+			matchers:  `{type = "any", matchers = [{type = "fake", id = "a"}, {type = "fake", id = "b"}]}`,
+			want:      false,
+			wantCalls: []string{"a", "b"},
+		},
+		{
+			name:      "all short-circuits on miss",
+			matchers:  `{type = "all", matchers = [{type = "fake", id = "a"}, {type = "fake", id = "b", fail = true}]}`,
+			want:      false,
+			wantCalls: []string{"a"},
+		},
+		{
+			name:      "not negates nested matchers",
+			matchers:  `{type = "not", matchers = [{type = "fake", id = "a", result = true}]}`,
+			want:      false,
+			wantCalls: []string{"a"},
+		},
+		{
+			name: "slack or teams but not github",
+			matchers: `
+				{type = "any", matchers = [{type = "fake", id = "slack"}, {type = "fake", id = "teams", result = true}]},
+				{type = "not", matchers = [{type = "fake", id = "github"}]}`,
+			want:      true,
+			wantCalls: []string{"slack", "teams", "github"},
+		},
+		{
+			name: "deeply nested",
+			matchers: `{type = "not", matchers = [
+				{type = "any", matchers = [
+					{type = "all", matchers = [{type = "fake", id = "a", result = true}, {type = "fake", id = "b"}]},
+					{type = "fake", id = "c"},
+				]},
+			]}`,
+			want:      true,
+			wantCalls: []string{"a", "b", "c"},
+		},
+		{
+			name:      "failed provider is not negated by not",
+			matchers:  `{type = "not", matchers = [{type = "fake", id = "a", provider_fail = true}]}`,
+			want:      false,
+			wantCalls: []string{"a"},
+		},
+		{
+			name:      "failed provider is unknown through any",
+			matchers:  `{type = "not", matchers = [{type = "any", matchers = [{type = "fake", id = "a", provider_fail = true}, {type = "fake", id = "b"}]}]}`,
+			want:      false,
+			wantCalls: []string{"a", "b"},
+		},
+		{
+			name:      "any matches despite failed provider",
+			matchers:  `{type = "any", matchers = [{type = "fake", id = "a", provider_fail = true}, {type = "fake", id = "b", result = true}]}`,
+			want:      true,
+			wantCalls: []string{"a", "b"},
+		},
+		{
+			name:      "not negates definite miss of all",
+			matchers:  `{type = "not", matchers = [{type = "all", matchers = [{type = "fake", id = "a", result = true}, {type = "fake", id = "b"}]}]}`,
+			want:      true,
+			wantCalls: []string{"a", "b"},
+		},
+		{
+			name:      "error propagates through composites",
+			matchers:  `{type = "not", matchers = [{type = "any", matchers = [{type = "fake", id = "a"}, {type = "fake", id = "b", fail = true}, {type = "fake", id = "c", result = true}]}]}`,
+			wantErr:   errFake,
+			wantCalls: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := configuration.ParseConfig("[[rules]]\ncommand = \"test\"\nmatchers = [" + tt.matchers + "]\n")
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+
+			fake := &fakeMatcherFactory{}
+			r := matchers.NewMatcherRegistry()
+			r.RegisterMatcher("fake", fake)
+			if err := c.Compile(r); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			e := &evaluator{req: matchers.NewRequest("https://example.com"), policy: c.OnProviderError}
+			got, _, err := e.matchAll(c.Rules[0].Matchers, slog.Default())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("matchAll() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("matchAll() = %v, want %v", got, tt.want)
+			}
+			if len(fake.calls) != len(tt.wantCalls) {
+				t.Fatalf("calls = %v, want %v", fake.calls, tt.wantCalls)
+			}
+			for i := range tt.wantCalls {
+				if fake.calls[i] != tt.wantCalls[i] {
+					t.Errorf("calls = %v, want %v", fake.calls, tt.wantCalls)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCompileUnknownMatcher(t *testing.T) {
+	c, err := configuration.ParseConfig(`
+[[rules]]
+command = "test"
+matchers = [{type = "any", matchers = [{type = "missing"}]}]
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	if err := c.Compile(matchers.NewMatcherRegistry()); err == nil {
+		t.Error("Compile() did not return error for unknown matcher")
+	}
+}
+
+func TestEvaluateDecision(t *testing.T) {
+	c, err := configuration.ParseConfig(`
+default_command = "personal"
+
+[command.work]
+cmd = ["firefox", "-p", "work", "{}"]
+
+[command.personal]
+cmd = "firefox {}"
+
+[[rules]]
+command = "work"
+matchers = [{type = "fake", id = "a"}]
+
+[[rules]]
+command = "work"
+matchers = [{type = "any", matchers = [{type = "fake", id = "b", result = true}]}]
+
+[[rules]]
+command = "personal"
+matchers = [{type = "fake", id = "c", result = true}]
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	r := matchers.NewMatcherRegistry()
+	r.RegisterMatcher("fake", &fakeMatcherFactory{})
+	if err := c.Compile(r); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	decision, err := evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+
+	if decision.MatchedRule != 1 || decision.Command != "work" {
+		t.Errorf("decision = rule %d command %q, want rule 1 command %q", decision.MatchedRule, decision.Command, "work")
+	}
+
+	wantArgv := []string{"firefox", "-p", "work", "https://example.com"}
+	if strings.Join(decision.Argv, " ") != strings.Join(wantArgv, " ") {
+		t.Errorf("Argv = %q, want %q", decision.Argv, wantArgv)
+	}
+
+	if len(decision.Rules) != 2 {
+		t.Fatalf("traced rules = %d, want 2", len(decision.Rules))
+	}
+	if decision.Rules[0].Matched || !decision.Rules[1].Matched {
+		t.Errorf("rule traces = %+v", decision.Rules)
+	}
+	if nested := decision.Rules[1].Matchers[0].Matchers; len(nested) != 1 || !nested[0].Matched {
+		t.Errorf("nested matcher traces = %+v", nested)
+	}
+
+	if c.Commands["work"].CMD[3] != "{}" {
+		t.Errorf("evaluate() modified command template: %q", c.Commands["work"].CMD)
+	}
+}
+
+// TestEvaluateLiteralBraces tests that configs written before templates keep
+// working, braces which are not known fields are passed literally and the
+// placeholder is replaced once per argument
+func TestEvaluateLiteralBraces(t *testing.T) {
+	c, err := configuration.ParseConfig(`
+default_command = "launcher"
+
+[command.launcher]
+cmd = ["launcher", "--class={foo}", '{"url": "{}", "copy": "{}"}', "\\{x}", "{url|nope}"]
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	r := matchers.NewMatcherRegistry()
+	if err := c.Compile(r); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	decision, err := evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+
+	wantArgv := []string{"launcher", "--class={foo}", `{"url": "https://example.com", "copy": "{}"}`, `\{x}`, "{url|nope}"}
+	if !slices.Equal(decision.Argv, wantArgv) {
+		t.Errorf("Argv = %q, want %q", decision.Argv, wantArgv)
+	}
+}
+
+func TestEvaluateClean(t *testing.T) {
+	c, err := configuration.ParseConfig(`
+default_command = "browser"
+
+[clean]
+enabled = true
+
+[command.browser]
+cmd = "firefox {}"
+
+[command.internal]
+cmd = "chromium {}"
+clean = false
+
+[[rules]]
+command = "internal"
+matchers = [{type = "fake", id = "internal", result = true}]
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	r := matchers.NewMatcherRegistry()
+	r.RegisterMatcher("fake", &fakeMatcherFactory{})
+	if err := c.Compile(r); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	const url = "https://example.com/?id=1&utm_source=mail"
+
+	decision, err := evaluate(c, r, url)
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if decision.Argv[1] != url {
+		t.Errorf("Argv = %q, want URL kept for command with clean = false", decision.Argv)
+	}
+
+	c.Rules = nil
+	decision, err = evaluate(c, r, url)
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if want := "https://example.com/?id=1"; decision.Argv[1] != want {
+		t.Errorf("Argv = %q, want cleaned URL %q", decision.Argv, want)
+	}
+}
+
+func TestEvaluateProviderError(t *testing.T) {
+	const rules = `
+default_command = "personal"
+
+[command.work]
+cmd = "firefox -p work {}"
+
+[command.personal]
+cmd = "firefox {}"
+
+[command.chooser]
+cmd = "chooser {}"
+
+[[rules]]
+command = "work"
+matchers = [{type = "not", matchers = [{type = "fake", id = "a", provider_fail = true}]}, {type = "fake", id = "b", result = true}]
+
+[[rules]]
+command = "work"
+matchers = [{type = "fake", id = "c", result = true}]
+`
+
+	tests := []struct {
+		name         string
+		policy       string
+		wantRule     int
+		wantCommand  string
+		wantFallback bool
+		wantErr      bool
+	}{
+		// Failed matcher is unknown, so even negated by not it fails the first rule
+		{name: "no match", policy: ``, wantRule: 1, wantCommand: "work"},
+		{name: "fail rule", policy: `on_provider_error = "fail_rule"`, wantRule: 1, wantCommand: "work"},
+		{name: "fail", policy: `on_provider_error = "fail"`, wantRule: -1, wantErr: true},
+		{
+			name:         "fail with fallback",
+			policy:       "on_provider_error = \"fail\"\nfallback_command = \"chooser\"",
+			wantRule:     -1,
+			wantCommand:  "chooser",
+			wantFallback: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := configuration.ParseConfig(tt.policy + rules)
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+
+			r := matchers.NewMatcherRegistry()
+			r.RegisterMatcher("fake", &fakeMatcherFactory{})
+			if err := c.Compile(r); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			decision, err := evaluate(c, r, "https://example.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if decision.MatchedRule != tt.wantRule || decision.Command != tt.wantCommand || decision.Fallback != tt.wantFallback {
+				t.Errorf("decision = rule %d command %q fallback %v, want rule %d command %q fallback %v",
+					decision.MatchedRule, decision.Command, decision.Fallback, tt.wantRule, tt.wantCommand, tt.wantFallback)
+			}
+
+			if len(decision.ProviderErrors) != 1 || !strings.Contains(decision.ProviderErrors[0], errFake.Error()) {
+				t.Errorf("ProviderErrors = %q, want single fake error", decision.ProviderErrors)
+			}
+			if decision.Rules[0].Matchers[0].Matchers[0].Error == "" {
+				t.Errorf("provider error is not traced: %+v", decision.Rules[0])
+			}
+		})
+	}
+}
+
+func TestEvaluateFallbacks(t *testing.T) {
+	c, err := configuration.ParseConfig(`
+default_command = "personal"
+
+[command.work]
+cmd = "firefox -p work {}"
+fallback = ["chromium", "personal"]
+launch_timeout = "2s"
+
+[command.personal]
+cmd = "firefox {}"
+
+[command.chromium]
+cmd = "chromium {}"
+
+[[rules]]
+command = "work"
+matchers = [{type = "fake", id = "a"}]
+fallback = ["zen"]
+
+[[rules]]
+command = "work"
+matchers = [{type = "fake", id = "b", result = true}]
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	r := matchers.NewMatcherRegistry()
+	r.RegisterMatcher("fake", &fakeMatcherFactory{})
+	if err := c.Compile(r); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	fallbackCommands := func(d *Decision) string {
+		names := make([]string, 0, len(d.Fallbacks))
+		for _, l := range d.Fallbacks {
+			names = append(names, l.Command)
+		}
+		return strings.Join(names, ",")
+	}
+
+	decision, err := evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if got, want := fallbackCommands(decision), "chromium,personal"; got != want {
+		t.Errorf("fallbacks = %q, want %q", got, want)
+	}
+	if decision.Timeout != 2*time.Second {
+		t.Errorf("Timeout = %s, want 2s", decision.Timeout)
+	}
+	// Detached fallbacks are watched when another fallback follows them
+	if decision.Fallbacks[0].Timeout != defaultLaunchWatch || decision.Fallbacks[1].Timeout != 0 {
+		t.Errorf("fallback timeouts = %s, %s, want %s, 0", decision.Fallbacks[0].Timeout, decision.Fallbacks[1].Timeout, defaultLaunchWatch)
+	}
+	if got := strings.Join(decision.Fallbacks[0].Argv, " "); got != "chromium https://example.com" {
+		t.Errorf("fallback argv = %q", got)
+	}
+
+	// Fallback of the rule overrides one of the command
+	c.Rules[0].Matchers[0].Matcher.(*fakeMatcher).config.Result = true
+	decision, err = evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if decision.Timeout != 2*time.Second {
+		t.Errorf("Timeout = %s, want launch_timeout kept", decision.Timeout)
+	}
+	if got, want := fallbackCommands(decision), "zen,personal"; got != want {
+		t.Errorf("fallbacks = %q, want %q", got, want)
+	}
+
+	work := c.Commands["work"]
+	work.LaunchTimeout = 0
+	c.Commands["work"] = work
+	decision, err = evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if decision.Timeout != defaultLaunchWatch {
+		t.Errorf("Timeout = %s, want detached command with fallbacks watched for %s", decision.Timeout, defaultLaunchWatch)
+	}
+
+	// Default command is not a fallback of itself
+	c.Rules = nil
+	decision, err = evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if len(decision.Fallbacks) != 0 {
+		t.Errorf("fallbacks = %q, want none", fallbackCommands(decision))
+	}
+	if decision.Timeout != 0 {
+		t.Errorf("Timeout = %s, want command without fallbacks not watched", decision.Timeout)
+	}
+}
+
+func TestEvaluateSystemdScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantScope bool
+	}{
+		{name: "disabled", config: "[command.browser]\ncmd = \"firefox {}\"\n"},
+		{name: "command", config: "[command.browser]\ncmd = \"firefox {}\"\nsystemd_scope = true\n", wantScope: true},
+		{name: "global", config: "systemd_scope = true\n[command.browser]\ncmd = \"firefox {}\"\n", wantScope: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := configuration.ParseConfig("default_command = \"browser\"\n" + tt.config)
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+
+			r := matchers.NewMatcherRegistry()
+			decision, err := evaluate(c, r, "https://example.com")
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+
+			want := "firefox https://example.com"
+			if tt.wantScope {
+				want = strings.Join(systemdScopeArgv, " ") + " " + want
+			}
+			if got := strings.Join(decision.Argv, " "); got != want {
+				t.Errorf("Argv = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// fieldMatcherFactory provides app fields to templates, every resolved field
+// is recorded
+type fieldMatcherFactory struct {
+	fakeMatcherFactory
+	resolved []string
+}
+
+func (f *fieldMatcherFactory) Field(name string) (string, bool) {
+	f.resolved = append(f.resolved, name)
+	return "value of " + name, true
+}
+
+func (f *fieldMatcherFactory) FieldNames() []string {
+	return []string{"class", "title", "pid"}
+}
+
+func TestSnapshotFields(t *testing.T) {
+	c, err := configuration.ParseConfig(`
+default_command = "personal"
+
+[command.chooser]
+type = "ask"
+cmd = ["dmenu", "-p", "{app.title}"]
+choices = ["work"]
+
+[command.work]
+cmd = ["firefox", "-P", "{app.class}", "{}"]
+fallback = ["backup"]
+
+[command.backup]
+cmd = ["chromium", "--class={app.class}", "{}"]
+
+[command.personal]
+cmd = ["firefox", "{}"]
+
+[command.unused]
+cmd = ["firefox", "{app.pid}", "{}"]
+
+[[rules]]
+command = "chooser"
+matchers = [{type = "app", id = "ask", result = true}]
+
+[[rules]]
+command = "work"
+matchers = [{type = "app", id = "work", result = true}]
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	app := &fieldMatcherFactory{}
+	r := matchers.NewMatcherRegistry()
+	r.RegisterMatcher("app", app)
+	if err := c.Compile(r); err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	// Choices and their fallbacks are resolved after the evaluation
+	decision, err := evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	fields := snapshotFields(c, r, decision)
+	if want := []string{"title", "class"}; !slices.Equal(app.resolved, want) {
+		t.Errorf("resolved fields = %q, want %q", app.resolved, want)
+	}
+	if value, ok := fields.Field("app.class"); !ok || value != "value of class" {
+		t.Errorf("Field(app.class) = %q, %v, want %q", value, ok, "value of class")
+	}
+	if fields.HasField("app.pid") {
+		t.Error("field of unused command is snapshotted")
+	}
+
+	// Launched command needs no fields, only default_command could be opened
+	// instead
+	c.Rules = c.Rules[1:]
+	decision, err = evaluate(c, r, "https://example.com")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	app.resolved = nil
+	snapshotFields(c, r, decision)
+	if len(app.resolved) != 0 {
+		t.Errorf("resolved fields = %q, want none", app.resolved)
+	}
+}
@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+)
+
+var errChooserTimeout = errors.New("chooser timed out")
+
+// askEntry is a line of the chooser menu
+type askEntry struct {
+	label    string
+	icon     string
+	command  string
+	remember bool
+}
+
+// ask runs the chooser of the ask command and resolves the decision to the
+// chosen command, argv is left empty when nothing is chosen
+func ask(c *configuration.Config, fields fieldResolver, d *Decision) error {
+	askCommand := c.Commands[d.AskCommand]
+
+	argv, err := buildArgv(askCommand, d.req, fields)
+	if err != nil {
+		return err
+	}
+
+	host := d.req.URL.Hostname()
+	entries := askEntries(c, askCommand, host)
+
+	i, err := runChooser(argv, entries, askCommand.Timeout)
+	switch {
+	case errors.Is(err, errChooserTimeout) && askCommand.Default != "":
+		slog.Info("Chooser timed out, using default", "command", askCommand.Default)
+		d.Command = askCommand.Default
+	case err != nil:
+		return err
+	case i == -1:
+		return nil
+	default:
+		d.Command = entries[i].command
+		if entries[i].remember {
+			if err := rememberChoice(c, host, d.Command); err != nil {
+				slog.Error("Failed to remember choice", "err", err)
+			}
+		}
+	}
+
+	d.Choices = nil
+	return resolveCommand(c, fields, d)
+}
+
+// askEntries lists choices of the ask command, followed by the same choices
+// remembered for the host if the command offers to remember
+func askEntries(c *configuration.Config, askCommand configuration.Command, host string) []askEntry {
+	entries := make([]askEntry, 0, len(askCommand.Choices))
+	for _, name := range askCommand.Choices {
+		command := c.Commands[name]
+		entries = append(entries, askEntry{
+			label:   command.DisplayLabel(name),
+			icon:    command.Icon,
+			command: name,
+		})
+	}
+
+	if !askCommand.Remember || host == "" {
+		return entries
+	}
+
+	for _, entry := range entries {
+		entry.label = fmt.Sprintf("%s (always for %s)", entry.label, host)
+		entry.remember = true
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// runChooser writes entries to stdin of the chooser, one per line, and
+// returns index of the entry printed to stdout, -1 when the chooser is
+// cancelled. Icons are passed with rofi extension supported by rofi and
+// fuzzel.
+func runChooser(argv []string, entries []askEntry, timeout time.Duration) (int, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var menu strings.Builder
+	for _, entry := range entries {
+		menu.WriteString(entry.label)
+		if entry.icon != "" {
+			menu.WriteString("\x00icon\x1f" + entry.icon)
+		}
+		menu.WriteByte('\n')
+	}
+
+	slog.Debug("Launching chooser", "command", argv)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(menu.String())
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = time.Second
+
+	out, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return -1, errChooserTimeout
+	}
+
+	selected := strings.TrimRight(string(out), "\r\n")
+	if err != nil {
+		// dmenu compatible choosers exit with non-zero code when cancelled
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && selected == "" {
+			return -1, nil
+		}
+		return -1, fmt.Errorf("failed to run chooser: %w", err)
+	}
+
+	if selected == "" {
+		return -1, nil
+	}
+	for i, entry := range entries {
+		if entry.label == selected {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("chooser returned unknown entry %q", selected)
+}
@@ -0,0 +1,139 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+const askConfig = `
+default_command = "ask"
+
+[command.ask]
+type = "ask"
+cmd = ["sh", "-c", '%s', "{hostname}"]
+timeout = "%s"
+default = "personal"
+remember = true
+
+[command.work]
+cmd = "firefox -p work {}"
+label = "Work"
+icon = "firefox"
+
+[command.personal]
+cmd = "firefox {}"
+`
+
+func TestRunChooser(t *testing.T) {
+	entries := []askEntry{{label: "Work"}, {label: "Personal"}}
+
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		want    int
+		wantErr error
+	}{
+		{name: "second line", script: "sed -n 2p", want: 1},
+		{name: "cancelled", script: "exit 1", want: -1},
+		{name: "nothing printed", script: "cat > /dev/null", want: -1},
+		{name: "timeout", script: "exec sleep 5", timeout: 100 * time.Millisecond, want: -1, wantErr: errChooserTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runChooser([]string{"sh", "-c", tt.script}, entries, tt.timeout)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("runChooser() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("runChooser() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := runChooser([]string{"echo", "Unknown"}, entries, 0); err == nil {
+		t.Errorf("runChooser() did not return error for unknown entry")
+	}
+}
+
+func TestAsk(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	menu := filepath.Join(t.TempDir(), "menu")
+
+	// Chooser saves the menu and picks "Work (always for example.com)"
+	script := "cat > " + menu + " && echo \"Work (always for $0)\""
+	c := compileAskConfig(t, script, "0s")
+
+	decision := evaluateAsk(t, c)
+	if decision.Command != "work" || decision.Remembered != "" {
+		t.Errorf("decision = command %q remembered for %q, want work chosen by chooser", decision.Command, decision.Remembered)
+	}
+	if want := "firefox -p work https://example.com/path"; strings.Join(decision.Argv, " ") != want {
+		t.Errorf("Argv = %q, want %q", decision.Argv, want)
+	}
+
+	data, err := os.ReadFile(menu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMenu := "personal\nWork\x00icon\x1ffirefox\n" +
+		"personal (always for example.com)\nWork (always for example.com)\x00icon\x1ffirefox\n"
+	if string(data) != wantMenu {
+		t.Errorf("menu = %q, want %q", data, wantMenu)
+	}
+
+	// The choice is remembered, so chooser is not run anymore
+	decision, err = evaluate(c, matchers.NewMatcherRegistry(), "https://EXAMPLE.com/other")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if decision.Command != "work" || decision.Remembered != "example.com" || decision.Choices != nil {
+		t.Errorf("decision = command %q remembered for %q choices %q, want work remembered for example.com", decision.Command, decision.Remembered, decision.Choices)
+	}
+}
+
+func TestAskTimeout(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	c := compileAskConfig(t, "exec sleep 5", "100ms")
+
+	decision := evaluateAsk(t, c)
+	if decision.Command != "personal" {
+		t.Errorf("Command = %q, want default personal", decision.Command)
+	}
+}
+
+func compileAskConfig(t *testing.T, script, timeout string) *configuration.Config {
+	t.Helper()
+
+	c, err := configuration.ParseConfig(strings.Replace(strings.Replace(askConfig, "%s", script, 1), "%s", timeout, 1))
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	return c
+}
+
+func evaluateAsk(t *testing.T, c *configuration.Config) *Decision {
+	t.Helper()
+
+	r := matchers.NewMatcherRegistry()
+	decision, err := evaluate(c, r, "https://example.com/path")
+	if err != nil {
+		t.Fatalf("evaluate() error = %v", err)
+	}
+	if decision.AskCommand != "ask" || strings.Join(decision.Choices, ",") != "personal,work" || decision.Argv != nil {
+		t.Fatalf("decision = %+v, want choices of ask command", decision)
+	}
+
+	if err := ask(c, r, decision); err != nil {
+		t.Fatalf("ask() error = %v", err)
+	}
+	return decision
+}
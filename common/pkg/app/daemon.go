@@ -0,0 +1,275 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/notify"
+)
+
+const (
+	// daemonRequestTimeout limits how long a client may take to send the
+	// request
+	daemonRequestTimeout = 5 * time.Second
+	// daemonResponseTimeout limits how long the client waits for the URL to
+	// be opened, including choosers and commands with wait
+	daemonResponseTimeout = 2 * time.Minute
+)
+
+// DaemonRequest is sent by the client to open the URL
+type DaemonRequest struct {
+	URL string `json:"url"`
+	// CallerPID is the parent process of the client, the caller matcher
+	// walks the chain from it
+	CallerPID int `json:"caller_pid,omitempty"`
+}
+
+type daemonResponse struct {
+	// Status is the exit status of the client
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Serve runs the daemon opening URLs sent by clients until it is interrupted.
+// The config is kept parsed and reloaded when the file changes, prepare
+// resets per request state of matchers before every URL.
+func Serve(configPath string, socketPath string, r *matchers.MatchersRegistry, n notify.Notifier, prepare func(DaemonRequest)) {
+	if socketPath == "" {
+		slog.Error("Daemon socket path is not set, set XDG_RUNTIME_DIR or pass -socket")
+		os.Exit(1)
+	}
+
+	d := &daemon{configPath: configPath, r: r, n: n, prepare: prepare}
+	if err := d.reloadConfig(); err != nil {
+		slog.Error("Failed to parse cofig file", "path", configPath, "err", err)
+		notifyConfigError(n, configPath, err)
+		os.Exit(1)
+	}
+
+	l, err := listen(socketPath)
+	if err != nil {
+		slog.Error("Failed to listen", "socket", socketPath, "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	slog.Info("Daemon is listening", "socket", socketPath)
+	if err := d.serve(l); err != nil {
+		slog.Error("Failed to accept connection", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("Daemon is stopped")
+}
+
+// Forward sends the URL to the daemon and returns exit status of opening it,
+// ok is false when the daemon is not running and the URL should be opened in
+// process
+func Forward(socketPath string, req DaemonRequest) (status int, ok bool) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		slog.Debug("Daemon is not available", "socket", socketPath, "err", err)
+		return 0, false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(daemonResponseTimeout))
+
+	// The daemon could not get the URL without the whole request, so opening
+	// it in process is safe
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		slog.Debug("Failed to send request to daemon", "err", err)
+		return 0, false
+	}
+
+	var resp daemonResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		slog.Error("Failed to read daemon response", "err", err)
+		return 1, true
+	}
+
+	if resp.Error != "" {
+		slog.Error("Daemon failed to open URL", "err", resp.Error)
+	}
+	return resp.Status, true
+}
+
+// listen listens on the socket, socket file left by a crashed daemon is
+// removed, while a running daemon is an error
+func listen(socketPath string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("daemon is already listening on %s", socketPath)
+	}
+
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+type daemon struct {
+	configPath string
+	r          *matchers.MatchersRegistry
+	n          notify.Notifier
+	prepare    func(DaemonRequest)
+
+	// mu serializes evaluation, matchers keep the context of the current
+	// request
+	mu      sync.Mutex
+	config  *configuration.Config
+	version configVersion
+}
+
+// configVersion identifies content of the config file, the path is resolved
+// since config files linked to immutable stores, e.g. by home-manager, keep
+// modification time on changes
+type configVersion struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func (d *daemon) serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		go d.handle(conn)
+	}
+}
+
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req DaemonRequest
+	conn.SetReadDeadline(time.Now().Add(daemonRequestTimeout))
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		slog.Error("Failed to read client request", "err", err)
+		return
+	}
+
+	slog.Debug("Client request", "url", req.URL, "caller pid", req.CallerPID)
+	status, notifyDecision, err := d.open(req)
+
+	var resp daemonResponse
+	resp.Status = status
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		slog.Debug("Failed to send response to client", "err", err)
+	}
+
+	// The notification waits for actions, so the client is not kept waiting
+	if notifyDecision != nil {
+		notifyDecision()
+	}
+}
+
+// open opens the URL, the returned function notifies about the decision. Only
+// the evaluation is serialized, choosers and commands run concurrently.
+func (d *daemon) open(req DaemonRequest) (int, func(), error) {
+	c, fields, decision, err := d.evaluate(req)
+	n := &notifier{n: d.n, config: c.Notify}
+	if err != nil {
+		slog.Error("Failed to evaluate", "err", err)
+		n.failure("Failed to route URL", req.URL, err)
+		return exitStatus(decision, err), nil, err
+	}
+
+	launched, err := launchDecision(c, fields, n, decision)
+	if err != nil || launched == nil {
+		return exitStatus(decision, err), nil, err
+	}
+
+	return exitStatus(decision, nil), func() { n.decision(c, fields, decision, *launched) }, nil
+}
+
+// evaluate decides how to open the URL with the request context set up by
+// prepare. Matcher fields are snapshotted while the context is valid, when
+// commands are resolved after the evaluation.
+func (d *daemon) evaluate(req DaemonRequest) (*configuration.Config, fieldResolver, *Decision, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.reloadConfig(); err != nil {
+		slog.Error("Failed to reload config file, keeping the previous one", "path", d.configPath, "err", err)
+		notifyConfigError(d.n, d.configPath, err)
+	}
+
+	if d.prepare != nil {
+		d.prepare(req)
+	}
+
+	decision, err := evaluate(d.config, d.r, req.URL)
+
+	var fields fieldSnapshot
+	if err == nil && (decision.Choices != nil || d.config.Notify.Decisions) {
+		fields = snapshotFields(d.config, d.r, decision)
+	}
+	return d.config, fields, decision, err
+}
+
+// reloadConfig loads the config file if it has changed since the last load,
+// the previous config is kept on error
+func (d *daemon) reloadConfig() error {
+	path, err := filepath.EvalSymlinks(d.configPath)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	version := configVersion{path: path, modTime: info.ModTime(), size: info.Size()}
+	if d.config != nil && version == d.version {
+		return nil
+	}
+
+	// The broken version is not retried until the file changes again
+	d.version = version
+	c, err := loadConfig(d.configPath, d.r)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Config is loaded", "path", d.configPath)
+	d.config = c
+	return nil
+}
@@ -0,0 +1,212 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+func writeDaemonConfig(t *testing.T, path string, marker string) {
+	t.Helper()
+
+	config := fmt.Sprintf(`
+default_command = "browser"
+
+[command.browser]
+cmd = ["touch", %q]
+wait = true
+
+[[rules]]
+command = "fail"
+matchers = [{type = "fake", id = "a", provider_fail = true}]
+`, marker)
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemon(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	socketPath := filepath.Join(dir, "autobrowser.sock")
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	writeDaemonConfig(t, configPath, first)
+
+	r := matchers.NewMatcherRegistry()
+	r.RegisterMatcher("fake", &fakeMatcherFactory{})
+
+	var prepared []DaemonRequest
+	d := &daemon{configPath: configPath, r: r, prepare: func(req DaemonRequest) { prepared = append(prepared, req) }}
+	if err := d.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+
+	l, err := listen(socketPath)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- d.serve(l) }()
+	t.Cleanup(func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("serve() error = %v", err)
+		}
+	})
+
+	if _, err := listen(socketPath); err == nil {
+		t.Error("listen() did not return error while the daemon is listening")
+	}
+
+	// Provider error of the fake matcher is reported with the status
+	status, ok := Forward(socketPath, DaemonRequest{URL: "https://example.com", CallerPID: 42})
+	if !ok || status != exitProviderError {
+		t.Errorf("Forward() = %d, %v, want %d, true", status, ok, exitProviderError)
+	}
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("URL is not opened: %v", err)
+	}
+	if len(prepared) != 1 || prepared[0].CallerPID != 42 {
+		t.Errorf("prepared requests = %+v, want caller pid 42", prepared)
+	}
+
+	// Size of the config changes, so the change is detected regardless of
+	// modification time resolution
+	writeDaemonConfig(t, configPath, second)
+	if _, ok := Forward(socketPath, DaemonRequest{URL: "https://example.com"}); !ok {
+		t.Fatal("Forward() did not reach the daemon")
+	}
+	if _, err := os.Stat(second); err != nil {
+		t.Errorf("changed config is not reloaded: %v", err)
+	}
+
+	// Broken config keeps the previous one
+	if err := os.WriteFile(configPath, []byte("[[rules]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(second)
+	if _, ok := Forward(socketPath, DaemonRequest{URL: "https://example.com"}); !ok {
+		t.Fatal("Forward() did not reach the daemon")
+	}
+	if _, err := os.Stat(second); err != nil {
+		t.Errorf("previous config is not kept: %v", err)
+	}
+}
+
+// TestDaemonConcurrentRequests tests that a request waiting for its command
+// does not block other requests
+func TestDaemonConcurrentRequests(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	socketPath := filepath.Join(dir, "autobrowser.sock")
+
+	// Slow URL waits until released, every URL leaves a file named by its path
+	// once opened
+	config := fmt.Sprintf(`
+default_command = "browser"
+
+[command.browser]
+cmd = ["sh", "-c", '''
+cd %q
+case "$0" in *slow) touch started; while [ ! -e release ]; do sleep 0.01; done;; esac
+touch "$(basename "$0")"
+''', "{}"]
+wait = true
+`, dir)
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &daemon{configPath: configPath, r: matchers.NewMatcherRegistry()}
+	if err := d.reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+
+	l, err := listen(socketPath)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- d.serve(l) }()
+	t.Cleanup(func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("serve() error = %v", err)
+		}
+	})
+
+	slow := make(chan bool)
+	go func() {
+		_, ok := Forward(socketPath, DaemonRequest{URL: "https://example.com/slow"})
+		slow <- ok
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(filepath.Join(dir, "started")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("waiting command is not started")
+		}
+	}
+
+	fast := make(chan bool)
+	go func() {
+		_, ok := Forward(socketPath, DaemonRequest{URL: "https://example.com/fast"})
+		fast <- ok
+	}()
+
+	select {
+	case ok := <-fast:
+		if !ok {
+			t.Fatal("Forward() did not reach the daemon")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request is blocked by the waiting one")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fast")); err != nil {
+		t.Errorf("URL is not opened: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "slow")); err == nil {
+		t.Error("waiting command finished before it was released")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "release"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ok := <-slow; !ok {
+		t.Fatal("Forward() did not reach the daemon")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "slow")); err != nil {
+		t.Errorf("URL is not opened: %v", err)
+	}
+}
+
+func TestForwardWithoutDaemon(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "autobrowser.sock")
+	if _, ok := Forward(socketPath, DaemonRequest{URL: "https://example.com"}); ok {
+		t.Error("Forward() = ok without daemon")
+	}
+}
+
+func TestListenRemovesStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "autobrowser.sock")
+
+	// Socket file is left when listener does not unlink it, like after crash
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listen(socketPath)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	l.Close()
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+// Decision describes how the URL was routed and why
+type Decision struct {
+	URL           string      `json:"url"`
+	Unwrapped     []string    `json:"unwrapped,omitempty"`
+	Rewrites      []int       `json:"rewrites,omitempty"`
+	TargetURL     string      `json:"target_url,omitempty"`
+	Rules         []RuleTrace `json:"rules"`
+	MatchedRule   int         `json:"matched_rule"`
+	Command       string      `json:"command"`
+	RemovedParams []string    `json:"removed_params,omitempty"`
+	Argv          []string    `json:"argv"`
+	Wait          bool        `json:"wait"`
+	// Timeout is launch_timeout of the command, Fallbacks are launched in
+	// order when it fails
+	Timeout   time.Duration `json:"timeout,omitempty"`
+	Fallbacks []Launch      `json:"fallbacks,omitempty"`
+	Error     string        `json:"error,omitempty"`
+
+	// ProviderErrors lists distinct errors of providers, Fallback is set when
+	// they stopped the evaluation and the fallback command is used
+	ProviderErrors []string `json:"provider_errors,omitempty"`
+	Fallback       bool     `json:"fallback,omitempty"`
+
+	// AskCommand is set when the decided command is an ask command, Choices
+	// are offered to the user unless the choice is remembered
+	AskCommand string   `json:"ask_command,omitempty"`
+	Choices    []string `json:"choices,omitempty"`
+	// Remembered is the host or domain the command is remembered for
+	Remembered string `json:"remembered,omitempty"`
+
+	// req is the request before cleaning, the chosen command is resolved
+	// with it
+	req *matchers.Request
+}
+
+// MarshalJSON encodes the timeout as a duration string like "1s"
+func (d Decision) MarshalJSON() ([]byte, error) {
+	type decision Decision
+	return json.Marshal(struct {
+		decision
+		Timeout string `json:"timeout,omitempty"`
+	}{decision(d), durationString(d.Timeout)})
+}
+
+// RuleTrace holds results of a single evaluated rule, rules after the matched
+// one are never evaluated and are absent from the trace
+type RuleTrace struct {
+	Rule     int            `json:"rule"`
+	Command  string         `json:"command"`
+	Matched  bool           `json:"matched"`
+	Error    string         `json:"error,omitempty"`
+	Matchers []MatcherTrace `json:"matchers"`
+}
+
+// MatcherTrace holds result of a single evaluated matcher, matchers skipped
+// due to short-circuiting are absent from the trace
+type MatcherTrace struct {
+	Type    string `json:"type"`
+	Matched bool   `json:"matched"`
+	// Unknown is set when the result depends on a failed provider, such
+	// matcher is not matched even when negated
+	Unknown  bool           `json:"unknown,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Matchers []MatcherTrace `json:"matchers,omitempty"`
+}
+
+// Explain evaluates the config for the URL without launching anything and
+// prints the decision trace to stdout
+func Explain(configPath string, urlString string, r *matchers.MatchersRegistry, jsonOutput bool) {
+	c, err := loadConfig(configPath, r)
+	if err != nil {
+		slog.Error("Failed to parse cofig file", "path", configPath, "err", err)
+		os.Exit(1)
+	}
+
+	decision, err := evaluate(c, r, urlString)
+	if err != nil {
+		decision.Error = err.Error()
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(decision); encErr != nil {
+			slog.Error("Failed to encode decision", "err", encErr)
+			os.Exit(1)
+		}
+	} else {
+		printDecision(os.Stdout, decision)
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+	if len(decision.ProviderErrors) > 0 {
+		os.Exit(exitProviderError)
+	}
+}
+
+func printDecision(w io.Writer, d *Decision) {
+	fmt.Fprintf(w, "URL: %s\n", d.URL)
+	if len(d.Unwrapped) > 0 {
+		fmt.Fprintf(w, "Unwrapped wrappers: %s\n", strings.Join(d.Unwrapped, ", "))
+	}
+	if len(d.Rewrites) > 0 {
+		fmt.Fprintf(w, "Applied rewrites: %v\n", d.Rewrites)
+	}
+
+	for _, rule := range d.Rules {
+		fmt.Fprintf(w, "\nRule %d -> %s: %s\n", rule.Rule, rule.Command, resultString(rule.Matched, rule.Error))
+		printMatchers(w, rule.Matchers, 1)
+	}
+
+	if len(d.ProviderErrors) > 0 {
+		fmt.Fprintln(w)
+		for _, err := range d.ProviderErrors {
+			fmt.Fprintf(w, "Provider error: %s\n", err)
+		}
+	}
+
+	if d.Error != "" {
+		fmt.Fprintf(w, "\nEvaluation failed: %s\n", d.Error)
+		return
+	}
+
+	// Ask command is replaced by the chosen one, but it is what was decided
+	decided := d.Command
+	if d.AskCommand != "" {
+		decided = d.AskCommand
+	}
+
+	fmt.Fprintln(w)
+	switch {
+	case d.Fallback:
+		fmt.Fprintf(w, "Evaluation failed, using fallback command: %s\n", decided)
+	case d.Remembered != "" && d.AskCommand == "":
+		fmt.Fprintf(w, "Command is remembered for %s: %s\n", d.Remembered, decided)
+	case d.MatchedRule == -1:
+		fmt.Fprintf(w, "No rules matched, using default command: %s\n", decided)
+	default:
+		fmt.Fprintf(w, "Rule %d matched, using command: %s\n", d.MatchedRule, decided)
+	}
+	if d.Remembered != "" && d.AskCommand != "" {
+		fmt.Fprintf(w, "Choice of %s is remembered for %s: %s\n", d.AskCommand, d.Remembered, d.Command)
+	}
+	if d.Choices != nil {
+		fmt.Fprintf(w, "Would ask to choose among: %s\n", strings.Join(d.Choices, ", "))
+		return
+	}
+	if len(d.RemovedParams) > 0 {
+		fmt.Fprintf(w, "Removed tracking parameters: %s\n", strings.Join(d.RemovedParams, ", "))
+	}
+	if d.TargetURL != "" {
+		fmt.Fprintf(w, "Target URL: %s\n", d.TargetURL)
+	}
+	printLaunch(w, Launch{Command: d.Command, Argv: d.Argv, Wait: d.Wait, Timeout: d.Timeout}, "Would")
+	for _, fallback := range d.Fallbacks {
+		printLaunch(w, fallback, "  On failure "+fallback.Command+" would")
+	}
+}
+
+func printLaunch(w io.Writer, l Launch, prefix string) {
+	switch {
+	case l.Wait && l.Timeout > 0:
+		fmt.Fprintf(w, "%s execute and wait up to %s: %q\n", prefix, l.Timeout, l.Argv)
+	case l.Wait:
+		fmt.Fprintf(w, "%s execute and wait: %q\n", prefix, l.Argv)
+	case l.Timeout > 0:
+		fmt.Fprintf(w, "%s execute detached, watching for %s: %q\n", prefix, l.Timeout, l.Argv)
+	default:
+		fmt.Fprintf(w, "%s execute detached: %q\n", prefix, l.Argv)
+	}
+}
+
+func printMatchers(w io.Writer, traces []MatcherTrace, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i, trace := range traces {
+		fmt.Fprintf(w, "%s- matcher %d (%s): %s\n", indent, i, trace.Type, matcherResultString(trace))
+		printMatchers(w, trace.Matchers, depth+1)
+	}
+}
+
+func matcherResultString(trace MatcherTrace) string {
+	if trace.Unknown && trace.Error == "" {
+		return "unknown, provider failed"
+	}
+	return resultString(trace.Matched, trace.Error)
+}
+
+func resultString(matched bool, err string) string {
+	switch {
+	case err != "":
+		return "error: " + err
+	case matched:
+		return "matched"
+	default:
+		return "not matched"
+	}
+}
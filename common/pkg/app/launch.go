@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// systemdScopeArgv is prepended to commands launched in their own systemd
+// scope, so the browser is not accounted to autobrowser's unit
+var systemdScopeArgv = []string{"systemd-run", "--user", "--scope", "--quiet", "--collect", "--"}
+
+// defaultLaunchWatch is how long detached commands followed by fallbacks are
+// watched for early failure when launch_timeout is not set
+const defaultLaunchWatch = time.Second
+
+// Launch is a command ready to be launched
+type Launch struct {
+	Command string        `json:"command"`
+	Argv    []string      `json:"argv"`
+	Wait    bool          `json:"wait"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// MarshalJSON encodes the timeout as a duration string like "1s"
+func (l Launch) MarshalJSON() ([]byte, error) {
+	type launch Launch
+	return json.Marshal(struct {
+		launch
+		Timeout string `json:"timeout,omitempty"`
+	}{launch(l), durationString(l.Timeout)})
+}
+
+// durationString formats the duration as the text output prints it, empty
+// for zero
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// launchAll launches the decided command and then its fallbacks in order
+// until one of them succeeds, it returns the launched one
+func launchAll(d *Decision) (Launch, error) {
+	launches := append([]Launch{{Command: d.Command, Argv: d.Argv, Wait: d.Wait, Timeout: d.Timeout}}, d.Fallbacks...)
+
+	var errs []error
+	for i, l := range launches {
+		err := runCommand(l.Argv, l.Wait, l.Timeout)
+		if err == nil {
+			if i > 0 {
+				slog.Info("Fallback command launched", "command", l.Command, "attempt", i+1)
+			}
+			return l, nil
+		}
+
+		slog.Error("Failed to launch command", "command", l.Command, "attempt", i+1, "err", err)
+		errs = append(errs, fmt.Errorf("%s: %w", l.Command, err))
+	}
+
+	return Launch{}, errors.Join(errs...)
+}
+
+func runCommand(cmd []string, wait bool, timeout time.Duration) error {
+	if len(cmd) == 0 {
+		return fmt.Errorf("command is empty")
+	}
+
+	if wait {
+		return runAndWait(cmd, timeout)
+	}
+	return runDetached(cmd, timeout)
+}
+
+// runAndWait runs the command and waits for it to exit, the command is killed
+// when it runs longer than the timeout
+func runAndWait(cmd []string, timeout time.Duration) error {
+	slog.Debug("Launching CMD", "command", cmd)
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.WaitDelay = time.Second
+
+	out, err := c.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Error("Command timed out", "timeout", timeout, "output", string(out))
+		return fmt.Errorf("command timed out after %s", timeout)
+	}
+	if err != nil {
+		slog.Error("Failed to run command", "err", err, "output", string(out))
+		return fmt.Errorf("failed to execute command: %w", err)
+	}
+
+	slog.Debug("Command executed successfully", "output", string(out))
+	return nil
+}
+
+// runDetached starts the command in its own session, command output goes to
+// autobrowser's stderr where the log is written. With the timeout the command
+// is watched for a while and exiting with an error in this time is a failure.
+// The command is waited for in background either way, so the daemon reaps it.
+func runDetached(cmd []string, timeout time.Duration) error {
+	slog.Debug("Launching CMD detached", "command", cmd)
+
+	c := exec.Command(cmd[0], cmd[1:]...)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := c.Start(); err != nil {
+		slog.Error("Failed to start command", "err", err)
+		return fmt.Errorf("failed to execute command: %w", err)
+	}
+
+	slog.Debug("Command started", "pid", c.Process.Pid)
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	if timeout <= 0 {
+		return nil
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("command failed: %w", err)
+		}
+		slog.Debug("Command exited successfully")
+	case <-time.After(timeout):
+		slog.Debug("Command is still running", "timeout", timeout)
+	}
+
+	return nil
+}
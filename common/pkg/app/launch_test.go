@@ -0,0 +1,216 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLaunchAll(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "launched")
+
+	tests := []struct {
+		name       string
+		decision   *Decision
+		wantErr    bool
+		wantMarker bool
+	}{
+		{
+			name: "primary succeeds",
+			decision: &Decision{
+				Command:   "primary",
+				Argv:      []string{"touch", marker},
+				Wait:      true,
+				Fallbacks: []Launch{{Command: "fallback", Argv: []string{"false"}, Wait: true}},
+			},
+			wantMarker: true,
+		},
+		{
+			name: "falls back after failure",
+			decision: &Decision{
+				Command: "primary",
+				Argv:    []string{"false"},
+				Wait:    true,
+				Fallbacks: []Launch{
+					{Command: "missing", Argv: []string{"autobrowser-missing-browser"}},
+					{Command: "fallback", Argv: []string{"touch", marker}, Wait: true},
+				},
+			},
+			wantMarker: true,
+		},
+		{
+			name: "detached failure within timeout",
+			decision: &Decision{
+				Command:   "primary",
+				Argv:      []string{"false"},
+				Timeout:   5 * time.Second,
+				Fallbacks: []Launch{{Command: "fallback", Argv: []string{"touch", marker}, Wait: true}},
+			},
+			wantMarker: true,
+		},
+		{
+			name: "detached running after timeout",
+			decision: &Decision{
+				Command:   "primary",
+				Argv:      []string{"sleep", "1"},
+				Timeout:   10 * time.Millisecond,
+				Fallbacks: []Launch{{Command: "fallback", Argv: []string{"touch", marker}, Wait: true}},
+			},
+		},
+		{
+			name: "wait timeout",
+			decision: &Decision{
+				Command:   "primary",
+				Argv:      []string{"sleep", "5"},
+				Wait:      true,
+				Timeout:   10 * time.Millisecond,
+				Fallbacks: []Launch{{Command: "fallback", Argv: []string{"touch", marker}, Wait: true}},
+			},
+			wantMarker: true,
+		},
+		{
+			name: "all fail",
+			decision: &Decision{
+				Command:   "primary",
+				Argv:      []string{"false"},
+				Wait:      true,
+				Fallbacks: []Launch{{Command: "fallback", Argv: []string{"false"}, Wait: true}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(marker)
+
+			_, err := launchAll(tt.decision)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("launchAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			_, statErr := os.Stat(marker)
+			if launched := statErr == nil; launched != tt.wantMarker {
+				t.Errorf("fallback launched = %v, want %v", launched, tt.wantMarker)
+			}
+		})
+	}
+}
+
+func TestDecisionJSON(t *testing.T) {
+	d := Decision{
+		Command:   "work",
+		Timeout:   1500 * time.Millisecond,
+		Fallbacks: []Launch{{Command: "backup", Timeout: time.Second}, {Command: "personal"}},
+	}
+
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var got struct {
+		Command   string `json:"command"`
+		Timeout   string `json:"timeout"`
+		Fallbacks []map[string]any
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.Command != "work" || got.Timeout != "1.5s" {
+		t.Errorf("decision = %s, want command work and timeout 1.5s", out)
+	}
+	if len(got.Fallbacks) != 2 || got.Fallbacks[0]["timeout"] != "1s" || got.Fallbacks[1]["timeout"] != nil {
+		t.Errorf("fallbacks = %v, want timeout 1s of the first one only", got.Fallbacks)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("detached", func(t *testing.T) {
+		marker := filepath.Join(dir, "detached")
+		if err := runCommand([]string{"touch", marker}, false, 0); err != nil {
+			t.Fatalf("runCommand() error = %v", err)
+		}
+
+		// Detached command is not waited for
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := os.Stat(marker); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("detached command did not write the marker")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("detached is reaped", func(t *testing.T) {
+		if _, err := os.Stat("/proc/self/stat"); err != nil {
+			t.Skip("procfs is not available")
+		}
+		if err := runCommand([]string{"true"}, false, 0); err != nil {
+			t.Fatalf("runCommand() error = %v", err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for zombieChildren(t) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("exited detached command is not reaped")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("wait reports exit status", func(t *testing.T) {
+		if err := runCommand([]string{"false"}, true, 0); err == nil {
+			t.Error("runCommand() did not return error for failed command")
+		}
+		if err := runCommand([]string{"true"}, true, 0); err != nil {
+			t.Errorf("runCommand() error = %v", err)
+		}
+	})
+
+	t.Run("missing executable", func(t *testing.T) {
+		if err := runCommand([]string{"autobrowser-missing-browser"}, false, 0); err == nil {
+			t.Error("runCommand() did not return error for missing executable")
+		}
+	})
+
+	t.Run("empty command", func(t *testing.T) {
+		if err := runCommand(nil, false, 0); err == nil {
+			t.Error("runCommand() did not return error for empty command")
+		}
+	})
+}
+
+// zombieChildren counts exited and not reaped children of the test process
+func zombieChildren(t *testing.T) int {
+	t.Helper()
+
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for _, path := range stats {
+		stat, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// State and parent pid follow the command name in parentheses
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) > 1 && fields[0] == "Z" && fields[1] == strconv.Itoa(os.Getpid()) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+	"github.com/pltanton/autobrowser/common/pkg/notify"
+)
+
+// actionOpenDefault is the key of the action reopening the URL with
+// default_command
+const actionOpenDefault = "open-default"
+
+// notifier sends notifications as configured, nil Notifier disables them
+type notifier struct {
+	n      notify.Notifier
+	config notify.Config
+}
+
+func (n *notifier) send(notification notify.Notification) string {
+	if n.n == nil {
+		return ""
+	}
+
+	notification.Timeout = n.config.WaitTimeout()
+	action, err := n.n.Notify(notification)
+	if err != nil {
+		slog.Debug("Failed to send notification", "err", err)
+		return ""
+	}
+	return action
+}
+
+// failure notifies about the error if failures are notified
+func (n *notifier) failure(summary string, urlString string, err error) {
+	if !n.config.NotifyFailures() {
+		return
+	}
+
+	n.send(notify.Notification{
+		Summary: summary,
+		Body:    urlString + "\n" + err.Error(),
+		Urgency: notify.UrgencyCritical,
+	})
+}
+
+// decision notifies about the launched command if decisions are notified,
+// the notification offers to open the URL with default_command instead
+func (n *notifier) decision(c *configuration.Config, fields fieldResolver, d *Decision, launched Launch) {
+	if !n.config.Decisions {
+		return
+	}
+
+	body := []string{decisionURL(d), decisionReason(d, launched)}
+	if len(d.ProviderErrors) > 0 {
+		body = append(body, "Provider errors: "+strings.Join(d.ProviderErrors, "; "))
+	}
+
+	notification := notify.Notification{
+		Summary: "Opened in " + lookupCommand(c, launched.Command).DisplayLabel(launched.Command),
+		Body:    strings.Join(body, "\n"),
+		Urgency: notify.UrgencyLow,
+	}
+
+	defaultCommand := lookupCommand(c, c.DefaultCommand)
+	offerDefault := c.DefaultCommand != "" && launched.Command != c.DefaultCommand && defaultCommand.Type != configuration.CommandAsk
+	if offerDefault {
+		notification.Actions = []notify.Action{{
+			Key:   actionOpenDefault,
+			Label: "Open in " + defaultCommand.DisplayLabel(c.DefaultCommand) + " instead",
+		}}
+	}
+
+	if n.send(notification) != actionOpenDefault {
+		return
+	}
+
+	slog.Info("Opening in default command instead", "command", c.DefaultCommand)
+	if err := openInstead(c, fields, d, c.DefaultCommand); err != nil {
+		slog.Error("Failed to open in default command", "err", err)
+		n.failure("Failed to open URL", decisionURL(d), err)
+	}
+}
+
+// notifyConfigError notifies about the config failed to load, the notify
+// section is read on its own to respect disabled failure notifications
+func notifyConfigError(n notify.Notifier, configPath string, err error) {
+	config, notifyErr := configuration.ParseNotifyConfig(configPath)
+	if notifyErr != nil {
+		slog.Debug("Failed to parse notify config, using defaults", "err", notifyErr)
+		config = notify.Config{}
+	}
+
+	(&notifier{n: n, config: config}).failure("Failed to parse autobrowser config", configPath, err)
+}
+
+// openInstead launches the URL of the decision with the given command
+func openInstead(c *configuration.Config, fields fieldResolver, d *Decision, command string) error {
+	instead := &Decision{
+		URL:         d.URL,
+		MatchedRule: -1,
+		Command:     command,
+		req:         d.req,
+	}
+	if err := resolveCommand(c, fields, instead); err != nil {
+		return err
+	}
+
+	_, err := launchAll(instead)
+	return err
+}
+
+func decisionURL(d *Decision) string {
+	if d.TargetURL != "" {
+		return d.TargetURL
+	}
+	return d.URL
+}
+
+// decisionReason describes why the launched command was used
+func decisionReason(d *Decision, launched Launch) string {
+	switch {
+	case launched.Command != d.Command:
+		return fmt.Sprintf("Fallback, %s failed to launch", d.Command)
+	case d.Remembered != "":
+		return "Remembered for " + d.Remembered
+	case d.AskCommand != "":
+		return "Chosen in " + d.AskCommand
+	case d.Fallback:
+		return "Fallback command, provider failed"
+	case d.MatchedRule != -1:
+		return fmt.Sprintf("Rule %d matched", d.MatchedRule)
+	default:
+		return "Default command, no rule matched"
+	}
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/notify"
+)
+
+// fakeNotifier records notifications and invokes the configured action
+type fakeNotifier struct {
+	action        string
+	notifications []notify.Notification
+}
+
+func (f *fakeNotifier) Notify(n notify.Notification) (string, error) {
+	f.notifications = append(f.notifications, n)
+	return f.action, nil
+}
+
+func TestOpenURLNotifications(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "default")
+
+	tests := []struct {
+		name        string
+		notify      string
+		work        string
+		action      string
+		wantErr     bool
+		wantSummary []string
+		wantActions int
+		wantDefault bool
+	}{
+		{name: "nothing by default", work: `["true"]`},
+		{
+			name:        "decision",
+			notify:      "decisions = true",
+			work:        `["true"]`,
+			wantSummary: []string{"Opened in Work"},
+			wantActions: 1,
+		},
+		{
+			name:        "open in default instead",
+			notify:      "decisions = true",
+			work:        `["true"]`,
+			action:      actionOpenDefault,
+			wantSummary: []string{"Opened in Work"},
+			wantActions: 1,
+			wantDefault: true,
+		},
+		{
+			name:        "launch failure",
+			work:        `["false"]`,
+			wantErr:     true,
+			wantSummary: []string{"Failed to open URL"},
+		},
+		{name: "failures disabled", notify: "failures = false", work: `["false"]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(marker)
+
+			c, err := configuration.ParseConfig(fmt.Sprintf(`
+default_command = "personal"
+
+[notify]
+%s
+
+[command.work]
+cmd = %s
+wait = true
+label = "Work"
+
+[command.personal]
+cmd = ["touch", %q]
+wait = true
+
+[[rules]]
+command = "work"
+matchers = [{type = "fake", id = "a", result = true}]
+`, tt.notify, tt.work, marker))
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+
+			// Default command is the fallback of work, it always fails to
+			// launch in tests of failures
+			if tt.wantErr {
+				c.DefaultCommand = ""
+			}
+
+			r := matchers.NewMatcherRegistry()
+			r.RegisterMatcher("fake", &fakeMatcherFactory{})
+			if err := c.Compile(r); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			fake := &fakeNotifier{action: tt.action}
+			_, err = openURL(c, r, &notifier{n: fake, config: c.Notify}, "https://example.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("openURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			summaries := make([]string, 0, len(fake.notifications))
+			for _, n := range fake.notifications {
+				summaries = append(summaries, n.Summary)
+				if !strings.Contains(n.Body, "https://example.com") {
+					t.Errorf("notification body = %q, want the URL", n.Body)
+				}
+			}
+			if strings.Join(summaries, ",") != strings.Join(tt.wantSummary, ",") {
+				t.Fatalf("notifications = %q, want %q", summaries, tt.wantSummary)
+			}
+			if len(fake.notifications) > 0 && len(fake.notifications[0].Actions) != tt.wantActions {
+				t.Errorf("actions = %+v, want %d", fake.notifications[0].Actions, tt.wantActions)
+			}
+
+			_, statErr := os.Stat(marker)
+			if opened := statErr == nil; opened != tt.wantDefault {
+				t.Errorf("opened in default = %v, want %v", opened, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestNotifyConfigError(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   int
+	}{
+		{name: "invalid toml", config: "[[rules]\n", want: 1},
+		{name: "invalid rules", config: "[[rules]]\nmatchers = [{type = \"any\"}]\n", want: 1},
+		{name: "failures disabled", config: "[notify]\nfailures = false\n[[rules]]\nmatchers = [{type = \"any\"}]\n", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := loadConfig(path, matchers.NewMatcherRegistry())
+			if err == nil {
+				t.Fatal("loadConfig() did not return error")
+			}
+
+			fake := &fakeNotifier{}
+			notifyConfigError(fake, path, err)
+			if len(fake.notifications) != tt.want {
+				t.Errorf("notifications = %+v, want %d", fake.notifications, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/choicestore"
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+)
+
+// useStickyChoice routes the decision with the command remembered for the
+// host, it reports whether there was one
+func useStickyChoice(c *configuration.Config, d *Decision) bool {
+	entry, ok := rememberedChoice(c, d.req.URL.Hostname(), func(command string) bool {
+		_, declared := c.Commands[command]
+		return declared
+	})
+	if !ok {
+		return false
+	}
+
+	d.Command = entry.Command
+	d.Remembered = entry.Key
+	return true
+}
+
+// rememberedChoice returns the choice remembered for the host or its domain,
+// if it is not expired and the command is accepted
+func rememberedChoice(c *configuration.Config, host string, accept func(command string) bool) (choicestore.Entry, bool) {
+	if host == "" {
+		return choicestore.Entry{}, false
+	}
+
+	store, err := loadChoices()
+	if err != nil {
+		slog.Error("Failed to load remembered choices", "err", err)
+		return choicestore.Entry{}, false
+	}
+
+	entry, ok := store.Lookup(host, c.Sticky.TTL, time.Now())
+	if !ok {
+		return choicestore.Entry{}, false
+	}
+	if !accept(entry.Command) {
+		slog.Debug("Remembered command is not accepted", "key", entry.Key, "command", entry.Command)
+		return choicestore.Entry{}, false
+	}
+
+	slog.Debug("Using remembered choice", "key", entry.Key, "command", entry.Command)
+	return entry, true
+}
+
+// rememberChoice stores the command for the host or its domain depending on
+// the sticky key, expired choices are dropped on the way
+func rememberChoice(c *configuration.Config, host, command string) error {
+	store, err := loadChoices()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	store.Prune(c.Sticky.TTL, now)
+	store.Set(c.Sticky.KeyFor(host), command, now)
+	return store.Save()
+}
+
+func loadChoices() (*choicestore.Store, error) {
+	path, err := choicestore.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return choicestore.Load(path)
+}
+
+// Choices manages remembered choices with list, add <host> <command> and
+// forget <host> actions
+func Choices(configPath string, args []string) {
+	c, err := configuration.ParseConfigFile(configPath)
+	if err != nil {
+		slog.Error("Failed to parse cofig file", "path", configPath, "err", err)
+		os.Exit(1)
+	}
+
+	if err := manageChoices(c, args, time.Now()); err != nil {
+		slog.Error("Failed to manage remembered choices", "err", err)
+		os.Exit(1)
+	}
+}
+
+func manageChoices(c *configuration.Config, args []string, now time.Time) error {
+	store, err := loadChoices()
+	if err != nil {
+		return err
+	}
+
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	switch {
+	case action == "list" && len(args) == 0:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, entry := range store.Entries() {
+			status := ""
+			if entry.Expired(c.Sticky.TTL, now) {
+				status = "expired"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Key, entry.Command, entry.Time.Local().Format(time.DateTime), status)
+		}
+		return w.Flush()
+	case action == "add" && len(args) == 2:
+		if _, ok := c.Commands[args[1]]; !ok {
+			return fmt.Errorf("command %q is not declared", args[1])
+		}
+		store.Set(args[0], args[1], now)
+		return store.Save()
+	case action == "forget" && len(args) == 1:
+		if !store.Delete(args[0]) {
+			return fmt.Errorf("no choice is remembered for %s", args[0])
+		}
+		return store.Save()
+	}
+
+	return fmt.Errorf("usage: choices [list | add <host> <command> | forget <host>]")
+}
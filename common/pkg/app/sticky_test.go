@@ -0,0 +1,147 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+const stickyRules = `
+default_command = "personal"
+
+[command.work]
+cmd = "firefox -p work {}"
+
+[command.personal]
+cmd = "firefox {}"
+
+[command.chromium]
+cmd = "chromium {}"
+
+[[rules]]
+command = "chromium"
+matchers = [{type = "fake", id = "a", result = true}]
+`
+
+func TestEvaluateSticky(t *testing.T) {
+	tests := []struct {
+		name           string
+		sticky         string
+		url            string
+		wantCommand    string
+		wantRemembered string
+	}{
+		{
+			name:           "before rules",
+			sticky:         "enabled = true",
+			url:            "https://jira.example.com",
+			wantCommand:    "work",
+			wantRemembered: "jira.example.com",
+		},
+		{
+			name:           "registrable domain",
+			sticky:         "enabled = true",
+			url:            "https://wiki.example.co.uk",
+			wantCommand:    "personal",
+			wantRemembered: "example.co.uk",
+		},
+		{
+			name:        "after rules",
+			sticky:      `enabled = true` + "\n" + `stage = "after_rules"`,
+			url:         "https://jira.example.com",
+			wantCommand: "chromium",
+		},
+		{
+			name:        "expired",
+			sticky:      `enabled = true` + "\n" + `ttl = "1h"`,
+			url:         "https://jira.example.com",
+			wantCommand: "chromium",
+		},
+		{
+			name:        "disabled",
+			url:         "https://jira.example.com",
+			wantCommand: "chromium",
+		},
+		{
+			name:        "undeclared command",
+			sticky:      "enabled = true",
+			url:         "https://old.example.com",
+			wantCommand: "chromium",
+		},
+	}
+
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	store, err := loadChoices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	store.Set("jira.example.com", "work", past)
+	store.Set("example.co.uk", "personal", past)
+	store.Set("old.example.com", "removed", past)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := configuration.ParseConfig(stickyRules + "\n[sticky]\n" + tt.sticky)
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+
+			r := matchers.NewMatcherRegistry()
+			r.RegisterMatcher("fake", &fakeMatcherFactory{})
+			if err := c.Compile(r); err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			decision, err := evaluate(c, r, tt.url)
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+			if decision.Command != tt.wantCommand || decision.Remembered != tt.wantRemembered {
+				t.Errorf("decision = command %q remembered for %q, want %q remembered for %q",
+					decision.Command, decision.Remembered, tt.wantCommand, tt.wantRemembered)
+			}
+		})
+	}
+}
+
+func TestManageChoices(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	c, err := configuration.ParseConfig(stickyRules)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	now := time.Now()
+
+	if err := manageChoices(c, []string{"add", "Example.com", "work"}, now); err != nil {
+		t.Fatalf("add error = %v", err)
+	}
+	if err := manageChoices(c, []string{"add", "example.org", "missing"}, now); err == nil {
+		t.Errorf("add did not return error for undeclared command")
+	}
+
+	store, err := loadChoices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if choice, ok := store.Get("example.com"); !ok || choice.Command != "work" {
+		t.Errorf("Get() = %+v, %v, want work", choice, ok)
+	}
+
+	if err := manageChoices(c, []string{"forget", "example.com"}, now); err != nil {
+		t.Fatalf("forget error = %v", err)
+	}
+	if err := manageChoices(c, []string{"forget", "example.com"}, now); err == nil {
+		t.Errorf("forget did not return error for unknown host")
+	}
+
+	if err := manageChoices(c, []string{"remove"}, now); err == nil {
+		t.Errorf("unknown action did not return error")
+	}
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/pltanton/autobrowser/common/pkg/configuration"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+// Validate checks the config file, prints found issues to stdout and exits
+// with non-zero code if any of them is an error
+func Validate(configPath string, r *matchers.MatchersRegistry) {
+	issues, err := configuration.ValidateFile(configPath, r)
+	if err != nil {
+		slog.Error("Failed to read config file", "path", configPath, "err", err)
+		os.Exit(1)
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue.Format(configPath))
+	}
+
+	if configuration.HasErrors(issues) {
+		os.Exit(1)
+	}
+
+	if len(issues) == 0 {
+		fmt.Printf("%s: OK\n", configPath)
+	}
+}
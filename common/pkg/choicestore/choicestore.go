@@ -0,0 +1,235 @@
+// Package choicestore persists commands chosen for hosts, so links to the
+// same host or domain are routed the same way
+package choicestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Config configures the [sticky] section
+type Config struct {
+	// Enabled makes remembered choices route links before or after rules
+	// depending on Stage, ask commands use them regardless
+	Enabled bool  `toml:"enabled"`
+	Stage   Stage `toml:"stage,omitempty"`
+	// Key decides whether choices are remembered for the host or for its
+	// registrable domain
+	Key KeyMode `toml:"key,omitempty"`
+	// TTL of remembered choices, they never expire when 0
+	TTL time.Duration `toml:"ttl,omitempty"`
+}
+
+type Stage string
+
+const (
+	// StageBeforeRules reuses remembered choices without evaluating rules,
+	// it is the default
+	StageBeforeRules Stage = "before_rules"
+	// StageAfterRules reuses remembered choices when no rule matched
+	StageAfterRules Stage = "after_rules"
+)
+
+type KeyMode string
+
+const (
+	KeyHost   KeyMode = "host"
+	KeyDomain KeyMode = "domain"
+)
+
+// Validate checks the config and sets defaults
+func (c *Config) Validate() error {
+	switch c.Stage {
+	case "":
+		c.Stage = StageBeforeRules
+	case StageBeforeRules, StageAfterRules:
+	default:
+		return fmt.Errorf("unknown stage %q, expected %q or %q", c.Stage, StageBeforeRules, StageAfterRules)
+	}
+
+	switch c.Key {
+	case "":
+		c.Key = KeyHost
+	case KeyHost, KeyDomain:
+	default:
+		return fmt.Errorf("unknown key %q, expected %q or %q", c.Key, KeyHost, KeyDomain)
+	}
+
+	if c.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+
+	return nil
+}
+
+// KeyFor returns the key choices for the host are remembered with
+func (c *Config) KeyFor(host string) string {
+	if c.Key == KeyDomain {
+		return Domain(host)
+	}
+	return strings.ToLower(host)
+}
+
+// Domain returns the registrable domain of the host, e.g. example.co.uk for
+// www.example.co.uk, or the host itself when it has none, e.g. for IPs
+func Domain(host string) string {
+	host = strings.ToLower(host)
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// Choice is a command remembered for a host
+type Choice struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+}
+
+// Expired reports whether the choice is older than ttl, choices never expire
+// when ttl is 0
+func (c Choice) Expired(ttl time.Duration, now time.Time) bool {
+	return ttl > 0 && now.Sub(c.Time) > ttl
+}
+
+// Entry is a choice with its key, lowercase host or domain
+type Entry struct {
+	Key string
+	Choice
+}
+
+// Store holds choices by lowercase host or domain, it is read and written as
+// a whole
+type Store struct {
+	path    string
+	choices map[string]Choice
+}
+
+// DefaultPath returns $XDG_STATE_HOME/autobrowser/choices.json, falling back
+// to ~/.local/state when XDG_STATE_HOME is not set
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get state directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, "autobrowser", "choices.json"), nil
+}
+
+// Load reads the store from the path, missing file is an empty store
+func Load(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		choices: map[string]Choice{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read choices: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.choices); err != nil {
+		return nil, fmt.Errorf("failed to parse choices %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Get returns the choice remembered with the key
+func (s *Store) Get(key string) (Choice, bool) {
+	choice, ok := s.choices[strings.ToLower(key)]
+	return choice, ok
+}
+
+// Lookup returns the choice remembered for the host or, if there is none,
+// for its registrable domain, expired choices are ignored
+func (s *Store) Lookup(host string, ttl time.Duration, now time.Time) (Entry, bool) {
+	for _, key := range []string{strings.ToLower(host), Domain(host)} {
+		if choice, ok := s.choices[key]; ok && !choice.Expired(ttl, now) {
+			return Entry{Key: key, Choice: choice}, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Set remembers the command with the key, call Save to persist it
+func (s *Store) Set(key, command string, now time.Time) {
+	s.choices[strings.ToLower(key)] = Choice{Command: command, Time: now}
+}
+
+// Delete forgets the choice remembered with the key, it reports whether
+// there was one
+func (s *Store) Delete(key string) bool {
+	key = strings.ToLower(key)
+	_, ok := s.choices[key]
+	delete(s.choices, key)
+	return ok
+}
+
+// Prune forgets expired choices
+func (s *Store) Prune(ttl time.Duration, now time.Time) {
+	for key, choice := range s.choices {
+		if choice.Expired(ttl, now) {
+			delete(s.choices, key)
+		}
+	}
+}
+
+// Entries returns remembered choices sorted by key
+func (s *Store) Entries() []Entry {
+	entries := make([]Entry, 0, len(s.choices))
+	for key, choice := range s.choices {
+		entries = append(entries, Entry{Key: key, Choice: choice})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// Save writes the store atomically, so concurrent autobrowser runs never see
+// partially written file
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s.choices, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".choices-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save choices: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save choices: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save choices: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save choices: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package choicestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autobrowser", "choices.json")
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, ok := s.Get("example.com"); ok {
+		t.Errorf("Get() found choice in empty store")
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.Set("Example.COM", "work", now)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	s, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	choice, ok := s.Get("example.com")
+	if !ok || choice.Command != "work" || !choice.Time.Equal(now) {
+		t.Errorf("Get() = %+v, %v, want work chosen at %v", choice, ok, now)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "choices.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	s.Set("jira.example.com", "work", now)
+	s.Set("example.com", "personal", now.Add(-2*time.Hour))
+	s.Set("example.co.uk", "personal", now)
+
+	tests := []struct {
+		host    string
+		ttl     time.Duration
+		wantKey string
+	}{
+		{host: "jira.example.com", wantKey: "jira.example.com"},
+		{host: "JIRA.example.com", wantKey: "jira.example.com"},
+		{host: "wiki.example.com", wantKey: "example.com"},
+		{host: "wiki.example.com", ttl: time.Hour},
+		{host: "www.example.co.uk", wantKey: "example.co.uk"},
+		{host: "co.uk"},
+		{host: "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		entry, ok := s.Lookup(tt.host, tt.ttl, now)
+		if ok != (tt.wantKey != "") || entry.Key != tt.wantKey {
+			t.Errorf("Lookup(%s, %v) = %+v, %v, want key %q", tt.host, tt.ttl, entry, ok, tt.wantKey)
+		}
+	}
+
+	s.Prune(time.Hour, now)
+	if !s.Delete("JIRA.example.com") || s.Delete("example.com") {
+		t.Errorf("Delete() reported wrong result, entries left: %+v", s.Entries())
+	}
+	if entries := s.Entries(); len(entries) != 1 || entries[0].Key != "example.co.uk" {
+		t.Errorf("Entries() = %+v, want example.co.uk only", entries)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	c := Config{Key: KeyDomain}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if c.Stage != StageBeforeRules {
+		t.Errorf("Stage = %q, want %q", c.Stage, StageBeforeRules)
+	}
+	if key := c.KeyFor("www.Example.com"); key != "example.com" {
+		t.Errorf("KeyFor() = %q, want example.com", key)
+	}
+
+	for _, c := range []Config{{Stage: "never"}, {Key: "path"}, {TTL: -time.Hour}} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) did not return error", c)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "choices.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Errorf("Load() did not return error for invalid file")
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+
+	path, err := DefaultPath()
+	if err != nil {
+		t.Fatalf("DefaultPath() error = %v", err)
+	}
+	if want := "/state/autobrowser/choices.json"; path != want {
+		t.Errorf("DefaultPath() = %q, want %q", path, want)
+	}
+}
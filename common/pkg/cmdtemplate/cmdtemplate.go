@@ -0,0 +1,215 @@
+// Package cmdtemplate expands command arguments templates like
+// "ext+container:name=Work&url={url|query}"
+package cmdtemplate
+
+import (
+	"encoding/base64"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// Fields resolves value of the field by its name
+type Fields func(name string) (string, bool)
+
+type Filter func(string) string
+
+var filters = map[string]Filter{
+	"query":     neturl.QueryEscape,
+	"path":      neturl.PathEscape,
+	"shell":     shellEscape,
+	"base64":    func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"base64url": func(s string) string { return base64.URLEncoding.EncodeToString([]byte(s)) },
+}
+
+var fieldRegexp = regexp.MustCompile(`^\{([a-zA-Z_][a-zA-Z0-9_.\-]*)((?:\|[a-z0-9_]+)*)\}`)
+
+// OriginalURLField is the URL autobrowser was called with, before unwrapping
+// and rewrites
+const OriginalURLField = "original_url"
+
+type part struct {
+	literal     string
+	placeholder bool
+	field       string
+	filters     []Filter
+}
+
+// Template is a parsed command argument
+type Template struct {
+	parts []part
+	// unknown are field references kept literally
+	unknown []string
+}
+
+// Parse parses the argument. Placeholder is the legacy placeholder replaced by
+// the whole URL, it takes precedence over fields and only its first occurrence
+// is replaced. Fields unknown to isField and unknown filters are kept
+// literally, so arguments like JSON pass through as they are.
+func Parse(arg string, placeholder string, isField func(name string) bool) *Template {
+	t := &Template{}
+	var literal strings.Builder
+
+	flush := func() {
+		if literal.Len() > 0 {
+			t.parts = append(t.parts, part{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	placeholderFound := false
+	for i := 0; i < len(arg); {
+		if placeholder != "" && !placeholderFound && strings.HasPrefix(arg[i:], placeholder) {
+			flush()
+			t.parts = append(t.parts, part{placeholder: true})
+			placeholderFound = true
+			i += len(placeholder)
+			continue
+		}
+
+		// Shell parameters like ${url} are kept as is for commands run by a
+		// shell
+		if arg[i] == '$' {
+			if m := fieldRegexp.FindString(arg[i+1:]); m != "" {
+				literal.WriteString(arg[i : i+1+len(m)])
+				i += 1 + len(m)
+				continue
+			}
+		}
+
+		if m := fieldRegexp.FindStringSubmatch(arg[i:]); m != nil {
+			if p, ok := parseField(m[1], m[2], isField); ok {
+				flush()
+				t.parts = append(t.parts, p)
+			} else {
+				t.unknown = append(t.unknown, m[0])
+				literal.WriteString(m[0])
+			}
+			i += len(m[0])
+			continue
+		}
+
+		literal.WriteByte(arg[i])
+		i++
+	}
+	flush()
+
+	return t
+}
+
+// parseField parses the field with its filters, ok is false if the field or
+// any of the filters is unknown
+func parseField(name string, filterNames string, isField func(name string) bool) (part, bool) {
+	if !isField(name) {
+		return part{}, false
+	}
+
+	p := part{field: name}
+	for _, filterName := range strings.Split(filterNames, "|")[1:] {
+		filter, ok := filters[filterName]
+		if !ok {
+			return part{}, false
+		}
+		p.filters = append(p.filters, filter)
+	}
+	return p, true
+}
+
+// HasPlaceholder reports whether the template references the URL either by
+// the placeholder or by any field
+func (t *Template) HasPlaceholder() bool {
+	for _, p := range t.parts {
+		if p.placeholder || p.field != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields returns names of the fields referenced by the template
+func (t *Template) Fields() []string {
+	var names []string
+	for _, p := range t.parts {
+		if p.field != "" {
+			names = append(names, p.field)
+		}
+	}
+	return names
+}
+
+// Unknown returns references to unknown fields or filters like "{hostnme}",
+// they are kept literally
+func (t *Template) Unknown() []string {
+	return t.unknown
+}
+
+// Expand substitutes placeholder and fields values
+func (t *Template) Expand(placeholderValue string, fields Fields) (string, error) {
+	var result strings.Builder
+
+	for _, p := range t.parts {
+		switch {
+		case p.placeholder:
+			result.WriteString(placeholderValue)
+		case p.field != "":
+			value, ok := fields(p.field)
+			if !ok {
+				return "", fmt.Errorf("unknown template field %q", p.field)
+			}
+			for _, filter := range p.filters {
+				value = filter(value)
+			}
+			result.WriteString(value)
+		default:
+			result.WriteString(p.literal)
+		}
+	}
+
+	return result.String(), nil
+}
+
+// URLFields resolves fields of the URL: url, scheme, user, host, hostname,
+// port, path, query, query.<param> and fragment
+func URLFields(rawURL string, u *neturl.URL) Fields {
+	return func(name string) (string, bool) {
+		switch name {
+		case "url":
+			return rawURL, true
+		case "scheme":
+			return u.Scheme, true
+		case "user":
+			return u.User.Username(), true
+		case "host":
+			return u.Host, true
+		case "hostname":
+			return u.Hostname(), true
+		case "port":
+			return u.Port(), true
+		case "path":
+			return u.Path, true
+		case "query":
+			return u.RawQuery, true
+		case "fragment":
+			return u.Fragment, true
+		}
+
+		if param, ok := strings.CutPrefix(name, "query."); ok {
+			return u.Query().Get(param), true
+		}
+
+		return "", false
+	}
+}
+
+// IsURLField reports whether the name is resolved by URLFields or is
+// OriginalURLField
+func IsURLField(name string) bool {
+	_, ok := URLFields("", &neturl.URL{})(name)
+	return ok || name == OriginalURLField
+}
+
+// shellEscape quotes the value to be safely used as a single POSIX shell word
+func shellEscape(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,91 @@
+package cmdtemplate
+
+import (
+	neturl "net/url"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	const rawURL = "https://user@example.com:8443/our org/repo?foo=bar&empty=#section"
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urlFields := URLFields(rawURL, u)
+	fields := func(name string) (string, bool) {
+		if name == "app.class" {
+			return "it's", true
+		}
+		return urlFields(name)
+	}
+	isField := func(name string) bool {
+		_, ok := fields(name)
+		return ok
+	}
+
+	tests := []struct {
+		name        string
+		arg         string
+		placeholder string
+		want        string
+	}{
+		{name: "literal", arg: "--new-window", placeholder: "{}", want: "--new-window"},
+		{name: "legacy placeholder", arg: "url={}", placeholder: "{}", want: "url=PLACEHOLDER"},
+		{name: "first placeholder replaced", arg: "{}|{}", placeholder: "{}", want: "PLACEHOLDER|{}"},
+		{name: "placeholder looking like field", arg: "{{url}}", placeholder: "{{url}}", want: "PLACEHOLDER"},
+		{name: "url", arg: "{url}", want: rawURL},
+		{name: "url parts", arg: "{scheme}://{hostname}:{port}{path}", want: "https://example.com:8443/our org/repo"},
+		{name: "host with port", arg: "{host}", want: "example.com:8443"},
+		{name: "user", arg: "{user}", want: "user"},
+		{name: "query", arg: "{query}", want: "foo=bar&empty="},
+		{name: "query param", arg: "{query.foo}", want: "bar"},
+		{name: "missing query param", arg: "[{query.missing}]", want: "[]"},
+		{name: "fragment", arg: "{fragment}", want: "section"},
+		{name: "external field", arg: "{app.class}", want: "it's"},
+		{name: "query filter", arg: "ext+container:name=Work&url={url|query}", want: "ext+container:name=Work&url=https%3A%2F%2Fuser%40example.com%3A8443%2Four+org%2Frepo%3Ffoo%3Dbar%26empty%3D%23section"},
+		{name: "path filter", arg: "{path|path}", want: "%2Four%20org%2Frepo"},
+		{name: "shell filter", arg: "{app.class|shell}", want: `'it'\''s'`},
+		{name: "base64 filter", arg: "{query.foo|base64}", want: "YmFy"},
+		{name: "chained filters", arg: "{query.foo|base64|query}", want: "YmFy"},
+		{name: "non field braces", arg: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "shell parameter", arg: `firefox --profile ${HOME}/p "$0"`, want: `firefox --profile ${HOME}/p "$0"`},
+		{name: "dollar before placeholder", arg: "${}", placeholder: "{}", want: "$PLACEHOLDER"},
+		{name: "awk program", arg: `awk '{print}' {url}`, want: "awk '{print}' " + rawURL},
+		{name: "unknown field", arg: "--class={foo}", want: "--class={foo}"},
+		{name: "unknown filter", arg: "{url|nope}", want: "{url|nope}"},
+		{name: "backslash before brace", arg: `\{url}`, want: `\` + rawURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.arg, tt.placeholder, isField).Expand("PLACEHOLDER", fields)
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	isField := func(name string) bool { return IsURLField(name) || name == "app.class" }
+	tmpl := Parse(`{}-{url|query}-${HOME}-{nope}-{app.class}-{url|nope}`, "{}", isField)
+
+	if got := strings.Join(tmpl.Fields(), ","); got != "url,app.class" {
+		t.Errorf("Fields() = %q, want %q", got, "url,app.class")
+	}
+	if got := strings.Join(tmpl.Unknown(), ","); got != "{nope},{url|nope}" {
+		t.Errorf("Unknown() = %q, want %q", got, "{nope},{url|nope}")
+	}
+
+	for name, want := range map[string]bool{"url": true, "query.foo": true, "original_url": true, "app.class": false, "HOME": false} {
+		if got := IsURLField(name); got != want {
+			t.Errorf("IsURLField(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -2,10 +2,16 @@ package configuration
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/pltanton/autobrowser/common/pkg/choicestore"
+	"github.com/pltanton/autobrowser/common/pkg/cmdtemplate"
 	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/notify"
+	"github.com/pltanton/autobrowser/common/pkg/urlx"
 )
 
 type Config struct {
@@ -13,31 +19,138 @@ type Config struct {
 	Commands       map[string]Command `toml:"command"`
 	Rules          []Rule             `toml:"rules"`
 
+	// Unwrap extracts destination URLs from redirect wrappers before matching
+	Unwrap    urlx.UnwrapConfig `toml:"unwrap"`
+	Unwrapper *urlx.Unwrapper   `toml:"-"`
+
+	// Rewrites are applied to the URL before matching
+	Rewrites []urlx.RewriteConfig `toml:"rewrites"`
+	Rewriter *urlx.Rewriter       `toml:"-"`
+
+	// Clean removes tracking query parameters before launching the command
+	Clean   urlx.CleanConfig `toml:"clean"`
+	Cleaner *urlx.Cleaner    `toml:"-"`
+
+	// SystemdScope launches every command through systemd-run --user --scope
+	SystemdScope bool `toml:"systemd_scope,omitempty"`
+
+	// Sticky reuses commands remembered for hosts
+	Sticky choicestore.Config `toml:"sticky"`
+
+	// Notify configures desktop notifications about decisions and failures
+	Notify notify.Config `toml:"notify"`
+
+	// OnProviderError decides how matchers failed to get the request context,
+	// e.g. the active window, affect the evaluation
+	OnProviderError ProviderErrorPolicy `toml:"on_provider_error,omitempty"`
+	// FallbackCommand opens the URL when the evaluation fails due to provider
+	// error with "fail" policy
+	FallbackCommand string `toml:"fallback_command,omitempty"`
+
 	md toml.MetaData
 }
 
+type ProviderErrorPolicy string
+
+const (
+	// ProviderErrorNoMatch treats the failed matcher as not matched, it is the
+	// default
+	ProviderErrorNoMatch ProviderErrorPolicy = "no_match"
+	// ProviderErrorFailRule treats the whole rule as not matched
+	ProviderErrorFailRule ProviderErrorPolicy = "fail_rule"
+	// ProviderErrorFail stops the evaluation and opens the URL with the
+	// fallback command if any
+	ProviderErrorFail ProviderErrorPolicy = "fail"
+)
+
 type Command struct {
 	CMD          []string       `toml:"-"`
 	CMDPrimitive toml.Primitive `toml:"cmd"`
 	Placeholder  string         `toml:"placeholder,omitempty"`
 	QueryEscape  bool           `toml:"query_escape,omitempty"`
+
+	// Wait keeps autobrowser running until the command exits instead of
+	// launching it detached
+	Wait bool `toml:"wait,omitempty"`
+	// SystemdScope launches the command through systemd-run --user --scope
+	SystemdScope bool `toml:"systemd_scope,omitempty"`
+	// Clean overrides global clean.enabled for the command
+	Clean *bool `toml:"clean,omitempty"`
+
+	// Fallback lists commands tried in order when the command fails to
+	// launch, default_command is tried the last
+	Fallback []string `toml:"fallback,omitempty"`
+	// LaunchTimeout limits how long the command may run when waited for, or
+	// how long a detached command is watched for early failure
+	LaunchTimeout time.Duration `toml:"launch_timeout,omitempty"`
+
+	// Label and Icon describe the command in ask menus, Label defaults to the
+	// command name
+	Label string `toml:"label,omitempty"`
+	Icon  string `toml:"icon,omitempty"`
+
+	// Type is CommandAsk for commands letting the user choose one of Choices
+	// with cmd, a chooser speaking dmenu protocol
+	Type CommandType `toml:"type,omitempty"`
+	// Choices are names of offered commands, all plain commands by default
+	Choices []string `toml:"choices,omitempty"`
+	// Default is used when the chooser does not answer within Timeout
+	Default string        `toml:"default,omitempty"`
+	Timeout time.Duration `toml:"timeout,omitempty"`
+	// Remember offers to remember the choice for the host of the URL
+	Remember bool `toml:"remember,omitempty"`
+}
+
+type CommandType string
+
+// CommandAsk asks the user which command should open the URL
+const CommandAsk CommandType = "ask"
+
+// DisplayLabel returns the label shown in ask menus
+func (c Command) DisplayLabel(name string) string {
+	if c.Label != "" {
+		return c.Label
+	}
+	return name
 }
 
 type Rule struct {
 	Command           string           `toml:"command"`
 	MatchersPrimitive []toml.Primitive `toml:"matchers"`
 	Matchers          []TypedMatcher   `toml:"-"`
+
+	// Fallback overrides fallback of the command
+	Fallback []string `toml:"fallback,omitempty"`
 }
 
 type TypedMatcher struct {
 	Type      string
 	Primitive toml.Primitive
+
+	// Matchers holds nested matchers of composite (any, all, not) matchers
+	Matchers []TypedMatcher
+
+	// Matcher is the compiled leaf matcher, set by Config.Compile
+	Matcher matchers.Matcher
 }
 
+// Composite matcher types, they are evaluated by the app itself and combine
+// nested matchers instead of delegating to the matchers registry
+const (
+	MatcherAll = "all"
+	MatcherAny = "any"
+	MatcherNot = "not"
+)
+
 type matcherType struct {
 	Type string `toml:"type"`
 }
 
+type compositeMatcher struct {
+	Type     string           `toml:"type"`
+	Matchers []toml.Primitive `toml:"matchers"`
+}
+
 func ParseConfigFile(path string) (*Config, error) {
 	var config Config
 	md, err := toml.DecodeFile(path, &config)
@@ -52,6 +165,18 @@ func ParseConfigFile(path string) (*Config, error) {
 	return &config, nil
 }
 
+// ParseNotifyConfig reads only the notify section of the config file, so
+// failures of the rest of the config could be notified as configured
+func ParseNotifyConfig(path string) (notify.Config, error) {
+	var config struct {
+		Notify notify.Config `toml:"notify"`
+	}
+	if _, err := toml.DecodeFile(path, &config); err != nil {
+		return notify.Config{}, err
+	}
+	return config.Notify, config.Notify.Validate()
+}
+
 func ParseConfig(str string) (*Config, error) {
 	var config Config
 	md, err := toml.Decode(str, &config)
@@ -67,48 +192,129 @@ func ParseConfig(str string) (*Config, error) {
 }
 
 func parseConfig(config *Config) error {
+	switch config.OnProviderError {
+	case "":
+		config.OnProviderError = ProviderErrorNoMatch
+	case ProviderErrorNoMatch, ProviderErrorFailRule, ProviderErrorFail:
+	default:
+		return fmt.Errorf("Unknown on_provider_error %q, expected one of %q, %q and %q",
+			config.OnProviderError, ProviderErrorNoMatch, ProviderErrorFailRule, ProviderErrorFail)
+	}
+
 	for name, command := range config.Commands {
 		if command.Placeholder == "" {
 			command.Placeholder = "{}"
 		}
 
 		var sliceCommand []string
-		err := config.md.PrimitiveDecode(command.CMDPrimitive, &sliceCommand)
-		if err == nil {
+		var stringCommand string
+		if err := config.md.PrimitiveDecode(command.CMDPrimitive, &sliceCommand); err == nil {
 			command.CMD = sliceCommand
-			config.Commands[name] = command
-			continue
+		} else if err := config.md.PrimitiveDecode(command.CMDPrimitive, &stringCommand); err == nil {
+			command.CMD = splitQuoted(stringCommand)
+		} else {
+			return fmt.Errorf("Failed to parse command cmd %s, cmd=%v", name, command.CMDPrimitive)
 		}
 
-		var stringCommand string
-		err = config.md.PrimitiveDecode(command.CMDPrimitive, &stringCommand)
-		if err == nil {
-			command.CMD = splitQuoted(stringCommand)
-			config.Commands[name] = command
-			continue
+		if command.Type != "" && command.Type != CommandAsk {
+			return fmt.Errorf("Unknown type %q of command %s", command.Type, name)
 		}
 
-		return fmt.Errorf("Failed to parse command cmd %s, cmd=%v", name, command.CMDPrimitive)
+		config.Commands[name] = command
 	}
 
-	for i, rule := range config.Rules {
-		config.Rules[i].Matchers = make([]TypedMatcher, len(rule.MatchersPrimitive))
+	for name, command := range config.Commands {
+		if command.Type != CommandAsk || len(command.Choices) > 0 {
+			continue
+		}
 
-		for j, matcher := range rule.MatchersPrimitive {
-			var matcherType matcherType
-			err := config.md.PrimitiveDecode(matcher, &matcherType)
-			if err != nil {
-				return fmt.Errorf("Failed to parse matcher type for rule %d, matcher %d", i, j)
+		for choice, c := range config.Commands {
+			if c.Type != CommandAsk {
+				command.Choices = append(command.Choices, choice)
 			}
+		}
+		slices.Sort(command.Choices)
+		config.Commands[name] = command
+	}
+
+	unwrapper, err := urlx.NewUnwrapper(config.Unwrap)
+	if err != nil {
+		return fmt.Errorf("Failed to parse unwrap: %w", err)
+	}
+	config.Unwrapper = unwrapper
+
+	rewriter, err := urlx.NewRewriter(config.Rewrites)
+	if err != nil {
+		return fmt.Errorf("Failed to parse rewrites: %w", err)
+	}
+	config.Rewriter = rewriter
+
+	config.Cleaner = urlx.NewCleaner(config.Clean)
+
+	if err := config.Sticky.Validate(); err != nil {
+		return fmt.Errorf("Failed to parse sticky: %w", err)
+	}
 
-			config.Rules[i].Matchers[j].Type = matcherType.Type
-			config.Rules[i].Matchers[j].Primitive = matcher
+	if err := config.Notify.Validate(); err != nil {
+		return fmt.Errorf("Failed to parse notify: %w", err)
+	}
+
+	for i, rule := range config.Rules {
+		matchers, err := parseMatchers(config.md, rule.MatchersPrimitive, fmt.Sprintf("rule %d", i))
+		if err != nil {
+			return err
 		}
+		config.Rules[i].Matchers = matchers
 	}
 
 	return nil
 }
 
+func parseMatchers(md toml.MetaData, primitives []toml.Primitive, path string) ([]TypedMatcher, error) {
+	result := make([]TypedMatcher, len(primitives))
+
+	for j, matcher := range primitives {
+		matcherPath := fmt.Sprintf("%s, matcher %d", path, j)
+
+		var matcherType matcherType
+		err := md.PrimitiveDecode(matcher, &matcherType)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse matcher type for %s", matcherPath)
+		}
+
+		result[j].Type = matcherType.Type
+		result[j].Primitive = matcher
+
+		if !IsComposite(matcherType.Type) {
+			continue
+		}
+
+		var composite compositeMatcher
+		if err := md.PrimitiveDecode(matcher, &composite); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s matcher for %s: %w", matcherType.Type, matcherPath, err)
+		}
+		if len(composite.Matchers) == 0 {
+			return nil, fmt.Errorf("Composite %s matcher for %s requires at least one nested matcher", matcherType.Type, matcherPath)
+		}
+
+		result[j].Matchers, err = parseMatchers(md, composite.Matchers, matcherPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// IsComposite reports whether the matcher type combines nested matchers
+func IsComposite(matcherType string) bool {
+	switch matcherType {
+	case MatcherAll, MatcherAny, MatcherNot:
+		return true
+	}
+	return false
+}
+
 func splitQuoted(s string) []string {
 	var result []string
 	var buf strings.Builder
@@ -153,6 +359,57 @@ func NewDefaultCommand(cmdString string) Command {
 	}
 }
 
+// Compile compiles every leaf matcher of the rules with the registry, so
+// invalid matcher configuration is reported before anything is evaluated
+func (c *Config) Compile(r *matchers.MatchersRegistry) error {
+	for i := range c.Rules {
+		if err := c.compileMatchers(r, c.Rules[i].Matchers, fmt.Sprintf("rule %d", i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TemplateField returns the check of template field names for
+// cmdtemplate.Parse, fields are resolved from the URL or by matchers, which
+// hasField reports
+func TemplateField(hasField func(key string) bool) func(name string) bool {
+	return func(name string) bool {
+		return cmdtemplate.IsURLField(name) || hasField(name)
+	}
+}
+
+func (c *Config) compileMatchers(r *matchers.MatchersRegistry, ms []TypedMatcher, path string) error {
+	for j := range ms {
+		matcherPath := fmt.Sprintf("%s, matcher %d", path, j)
+
+		if IsComposite(ms[j].Type) {
+			if err := c.compileMatchers(r, ms[j].Matchers, matcherPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		matcher, err := r.Compile(ms[j].Type, c.ConfigProvider(ms[j]))
+		if err != nil {
+			return fmt.Errorf("failed to compile %s matcher for %s: %w", ms[j].Type, matcherPath, err)
+		}
+		ms[j].Matcher = matcher
+	}
+
+	return nil
+}
+
+// ShouldClean reports whether tracking parameters should be removed from URLs
+// opened by the command
+func (c *Config) ShouldClean(command Command) bool {
+	if command.Clean != nil {
+		return *command.Clean
+	}
+	return c.Clean.Enabled
+}
+
 func (c *Config) ConfigProvider(matcher TypedMatcher) matchers.MatcherConfigProvider {
 	return func(v any) error { return c.md.PrimitiveDecode(matcher.Primitive, v) }
 }
@@ -2,7 +2,13 @@
 package configuration
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
 )
 
 // TestParseConfig tests the configuration parser with various inputs
@@ -90,6 +96,115 @@ matchers = [
 		}
 	})
 
+	// Test config with nested composite matchers
+	t.Run("config with composite matchers", func(t *testing.T) {
+		input := `
+[[rules]]
+command = "test"
+[[rules.matchers]]
+type = "any"
+matchers = [
+    { type = "app", class = "Slack" },
+    { type = "all", matchers = [{ type = "app", class = "Teams" }] },
+]
+[[rules.matchers]]
+type = "not"
+matchers = [{ type = "url", host = "github.com" }]
+`
+		config, err := ParseConfig(input)
+		if err != nil {
+			t.Fatalf("ParseConfig() error = %v", err)
+		}
+
+		matchers := config.Rules[0].Matchers
+		if len(matchers) != 2 {
+			t.Fatalf("Matchers count = %d, want 2", len(matchers))
+		}
+
+		if matchers[0].Type != MatcherAny || len(matchers[0].Matchers) != 2 {
+			t.Errorf("First matcher = %q with %d nested, want %q with 2", matchers[0].Type, len(matchers[0].Matchers), MatcherAny)
+		}
+
+		nested := matchers[0].Matchers[1]
+		if nested.Type != MatcherAll || len(nested.Matchers) != 1 || nested.Matchers[0].Type != "app" {
+			t.Errorf("Nested all matcher parsed incorrectly: %+v", nested)
+		}
+
+		if matchers[1].Type != MatcherNot || len(matchers[1].Matchers) != 1 || matchers[1].Matchers[0].Type != "url" {
+			t.Errorf("Not matcher parsed incorrectly: %+v", matchers[1])
+		}
+	})
+
+	// Test composite matcher without nested matchers
+	t.Run("empty composite matcher", func(t *testing.T) {
+		input := `
+[[rules]]
+command = "test"
+matchers = [{ type = "not" }]
+`
+		if _, err := ParseConfig(input); err == nil {
+			t.Errorf("ParseConfig() did not return error for empty composite matcher")
+		}
+	})
+
+	// Test ask command
+	t.Run("ask command", func(t *testing.T) {
+		config, err := ParseConfig(`
+[command.ask]
+type = "ask"
+cmd = "fuzzel --dmenu"
+timeout = "30s"
+
+[command.work]
+cmd = "firefox -p work {}"
+
+[command.personal]
+cmd = "firefox {}"
+`)
+		if err != nil {
+			t.Fatalf("ParseConfig() error = %v", err)
+		}
+
+		ask := config.Commands["ask"]
+		if strings.Join(ask.Choices, ",") != "personal,work" {
+			t.Errorf("Choices = %q, want all plain commands", ask.Choices)
+		}
+		if ask.Timeout != 30*time.Second {
+			t.Errorf("Timeout = %v, want 30s", ask.Timeout)
+		}
+
+		if _, err := ParseConfig("[command.x]\ntype = \"menu\"\ncmd = \"x {}\""); err == nil {
+			t.Errorf("ParseConfig() did not return error for unknown command type")
+		}
+	})
+
+	// Test provider error policy
+	t.Run("provider error policy", func(t *testing.T) {
+		config, err := ParseConfig(`default_command = "open"`)
+		if err != nil {
+			t.Fatalf("ParseConfig() error = %v", err)
+		}
+		if config.OnProviderError != ProviderErrorNoMatch {
+			t.Errorf("OnProviderError = %q, want %q", config.OnProviderError, ProviderErrorNoMatch)
+		}
+
+		config, err = ParseConfig(`
+on_provider_error = "fail"
+fallback_command = "chooser"
+`)
+		if err != nil {
+			t.Fatalf("ParseConfig() error = %v", err)
+		}
+		if config.OnProviderError != ProviderErrorFail || config.FallbackCommand != "chooser" {
+			t.Errorf("OnProviderError = %q, FallbackCommand = %q, want %q and %q",
+				config.OnProviderError, config.FallbackCommand, ProviderErrorFail, "chooser")
+		}
+
+		if _, err := ParseConfig(`on_provider_error = "ignore"`); err == nil {
+			t.Errorf("ParseConfig() did not return error for unknown on_provider_error")
+		}
+	})
+
 	// Test invalid configuration
 	t.Run("invalid config", func(t *testing.T) {
 		input := `
@@ -102,3 +217,58 @@ cmd = 123  # This should cause an error - cmd must be string or array
 		}
 	})
 }
+
+// TestCompile tests matchers compilation with the registry
+func TestCompile(t *testing.T) {
+	r := matchers.NewMatcherRegistry()
+	r.RegisterMatcher("re", regexMatcherFactory{})
+
+	config, err := ParseConfig(`
+[[rules]]
+command = "test"
+matchers = [{ type = "re", regex = "ok" }, { type = "any", matchers = [{ type = "re", regex = "(" }] }]
+`)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+
+	err = config.Compile(r)
+	if err == nil {
+		t.Fatal("Compile() did not return error for invalid regex")
+	}
+	if !strings.Contains(err.Error(), "rule 0, matcher 1, matcher 0") {
+		t.Errorf("Compile() error = %q, want rule and matcher indices", err)
+	}
+
+	if config.Rules[0].Matchers[0].Matcher == nil {
+		t.Error("Compile() did not set compiled matcher")
+	}
+}
+
+func TestParseNotifyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(`
+[notify]
+failures = false
+timeout = "3s"
+
+[[rules]]
+command = "test"
+matchers = [{ type = "any" }]
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseConfigFile(path); err == nil {
+		t.Fatal("ParseConfigFile() did not return error for composite matcher without matchers")
+	}
+
+	config, err := ParseNotifyConfig(path)
+	if err != nil {
+		t.Fatalf("ParseNotifyConfig() error = %v", err)
+	}
+	if config.NotifyFailures() || config.WaitTimeout() != 3*time.Second {
+		t.Errorf("ParseNotifyConfig() = %+v, want failures disabled and 3s timeout", config)
+	}
+}
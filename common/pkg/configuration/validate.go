@@ -0,0 +1,336 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pltanton/autobrowser/common/pkg/cmdtemplate"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a single problem found in the configuration, Line is 0 when the
+// position is unknown
+type Issue struct {
+	Severity Severity
+	Line     int
+	Message  string
+}
+
+// Format formats the issue in compiler-like style prefixed by the file path
+func (i Issue) Format(path string) string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", path, i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", path, i.Line, i.Severity, i.Message)
+}
+
+// HasErrors reports whether any of issues is an error
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFile checks the configuration file in a strict way: every matcher
+// is compiled with the registry and any key left undecoded is reported as
+// unknown
+func ValidateFile(path string, r *matchers.MatchersRegistry) ([]Issue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Validate(string(data), r), nil
+}
+
+func Validate(str string, r *matchers.MatchersRegistry) []Issue {
+	v := validator{
+		r:       r,
+		locator: newLocator(str),
+	}
+
+	var config Config
+	md, err := toml.Decode(str, &config)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			v.errorf(parseErr.Position.Line, "%s", parseErr.Message)
+		} else {
+			v.errorf(0, "%s", err)
+		}
+		return v.issues
+	}
+
+	config.md = md
+	if err := parseConfig(&config); err != nil {
+		v.errorf(0, "%s", err)
+		return v.issues
+	}
+
+	v.config = &config
+	v.validateCommands()
+	v.validateRules()
+	v.validateUndecoded()
+
+	sort.SliceStable(v.issues, func(i, j int) bool { return v.issues[i].Line < v.issues[j].Line })
+	return v.issues
+}
+
+type validator struct {
+	r       *matchers.MatchersRegistry
+	config  *Config
+	issues  []Issue
+	locator *locator
+}
+
+func (v *validator) errorf(line int, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Severity: SeverityError, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(line int, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Severity: SeverityWarning, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validateCommands() {
+	isField := TemplateField(v.r.HasField)
+	for name, command := range v.config.Commands {
+		line := v.locator.command(name)
+
+		if len(command.CMD) == 0 || command.CMD[0] == "" {
+			v.errorf(line, "command %q has empty cmd", name)
+			continue
+		}
+
+		var unknown []string
+		for _, arg := range command.CMD {
+			unknown = append(unknown, cmdtemplate.Parse(arg, command.Placeholder, isField).Unknown()...)
+		}
+		if len(unknown) > 0 {
+			v.warnf(line, "command %q has unknown template fields %q, they are passed literally", name, unknown)
+		}
+
+		if command.Type == CommandAsk {
+			v.validateAsk(name, command, line)
+			continue
+		}
+
+		v.validateFallback(fmt.Sprintf("command %q", name), command.Fallback, line)
+		if command.LaunchTimeout < 0 {
+			v.errorf(line, "launch_timeout of command %q is negative", name)
+		}
+
+		hasPlaceholder := false
+		for _, arg := range command.CMD {
+			if cmdtemplate.Parse(arg, command.Placeholder, isField).HasPlaceholder() {
+				hasPlaceholder = true
+				break
+			}
+		}
+		if !hasPlaceholder {
+			v.errorf(line, "command %q contains neither placeholder %q nor template fields, URL will not be passed", name, command.Placeholder)
+		}
+	}
+
+	switch {
+	case v.config.DefaultCommand == "":
+		v.errorf(0, "default_command is not set")
+	case !v.isDeclared(v.config.DefaultCommand):
+		v.warnf(v.locator.find(regexp.MustCompile(`(?m)^\s*default_command\s*=`)), "default_command %q is not declared, it will be used as is", v.config.DefaultCommand)
+	}
+
+	fallbackLine := v.locator.find(regexp.MustCompile(`(?m)^\s*fallback_command\s*=`))
+	switch {
+	case v.config.FallbackCommand != "" && v.config.OnProviderError != ProviderErrorFail:
+		v.warnf(fallbackLine, "fallback_command is used with on_provider_error = %q only", ProviderErrorFail)
+	case v.config.FallbackCommand != "" && !v.isDeclared(v.config.FallbackCommand):
+		v.warnf(fallbackLine, "fallback_command %q is not declared, it will be used as is", v.config.FallbackCommand)
+	case v.config.FallbackCommand == "" && v.config.OnProviderError == ProviderErrorFail:
+		v.warnf(v.locator.find(regexp.MustCompile(`(?m)^\s*on_provider_error\s*=`)), "fallback_command is not set, URLs will not be opened on provider errors")
+	}
+}
+
+// validateAsk checks choices of the ask command, its cmd is a chooser which
+// does not need the URL
+func (v *validator) validateAsk(name string, command Command, line int) {
+	for _, choice := range command.Choices {
+		switch c, ok := v.config.Commands[choice]; {
+		case !ok:
+			v.errorf(line, "command %q offers undeclared command %q", name, choice)
+		case c.Type == CommandAsk:
+			v.errorf(line, "command %q offers ask command %q", name, choice)
+		}
+	}
+
+	if command.Default != "" && !slices.Contains(command.Choices, command.Default) {
+		v.errorf(line, "default %q of command %q is not one of its choices", command.Default, name)
+	}
+	if command.Timeout < 0 {
+		v.errorf(line, "timeout of command %q is negative", name)
+	}
+}
+
+// validateFallback checks commands of the fallback list, ask commands can't
+// be fallbacks since nobody is asked on failure
+func (v *validator) validateFallback(owner string, fallback []string, line int) {
+	for _, name := range fallback {
+		switch command, ok := v.config.Commands[name]; {
+		case !ok:
+			v.warnf(line, "%s falls back to undeclared command %q, it will be used as is", owner, name)
+		case command.Type == CommandAsk:
+			v.errorf(line, "%s falls back to ask command %q", owner, name)
+		}
+	}
+}
+
+func (v *validator) validateRules() {
+	for i, rule := range v.config.Rules {
+		line := v.locator.rule(i)
+
+		switch {
+		case rule.Command == "":
+			v.errorf(line, "rule %d has no command", i)
+		case !v.isDeclared(rule.Command):
+			v.warnf(line, "rule %d refers to undeclared command %q, it will be used as is", i, rule.Command)
+		}
+
+		v.validateFallback(fmt.Sprintf("rule %d", i), rule.Fallback, line)
+		v.validateMatchers(rule.Matchers, fmt.Sprintf("rule %d", i))
+	}
+}
+
+func (v *validator) validateMatchers(ms []TypedMatcher, path string) {
+	for j, m := range ms {
+		matcherPath := fmt.Sprintf("%s, matcher %d", path, j)
+		line := v.locator.matcher(m.Type)
+
+		if IsComposite(m.Type) {
+			v.validateMatchers(m.Matchers, matcherPath)
+			continue
+		}
+
+		if _, err := v.r.Compile(m.Type, v.config.ConfigProvider(m)); err != nil {
+			v.errorf(line, "%s: %s", matcherPath, err)
+			// Mark keys of the matcher as decoded to not report them twice
+			var ignored map[string]any
+			_ = v.config.md.PrimitiveDecode(m.Primitive, &ignored)
+		}
+	}
+}
+
+func (v *validator) validateUndecoded() {
+	undecoded := v.config.md.Undecoded()
+
+	reported := map[string]bool{}
+	for _, key := range undecoded {
+		reported[key.String()] = true
+	}
+
+	for _, key := range undecoded {
+		// Report only the topmost unknown key
+		if len(key) > 1 && reported[toml.Key(key[:len(key)-1]).String()] {
+			continue
+		}
+		v.errorf(v.locator.key(key), "unknown key %s", key)
+	}
+}
+
+func (v *validator) isDeclared(command string) bool {
+	_, ok := v.config.Commands[command]
+	return ok
+}
+
+// locator finds best-effort line numbers of config entities, since the TOML
+// decoder does not expose positions of decoded values. Rules and matchers are
+// looked up in document order.
+type locator struct {
+	text string
+
+	matcherCursor int
+	keyCursors    map[string]int
+}
+
+var rulesHeaderRegexp = regexp.MustCompile(`(?m)^\s*\[\[\s*rules\s*\]\]`)
+
+func newLocator(str string) *locator {
+	return &locator{
+		text:       str,
+		keyCursors: map[string]int{},
+	}
+}
+
+// find returns line number of the first match of the regexp
+func (l *locator) find(re *regexp.Regexp) int {
+	line, _ := l.findFrom(0, re)
+	return line
+}
+
+// findFrom returns line number and offset of the first match of the regexp
+// after the offset, line number is 0 when nothing found
+func (l *locator) findFrom(offset int, re *regexp.Regexp) (int, int) {
+	loc := re.FindStringIndex(l.text[offset:])
+	if loc == nil {
+		return 0, offset
+	}
+
+	// Matches may start with separators preceding the entity itself
+	start := offset + loc[0]
+	for start < offset+loc[1] && strings.ContainsRune(" \t\r\n{,.[", rune(l.text[start])) {
+		start++
+	}
+
+	return l.lineAt(start), offset + loc[1]
+}
+
+func (l *locator) lineAt(offset int) int {
+	return strings.Count(l.text[:offset], "\n") + 1
+}
+
+func (l *locator) rule(n int) int {
+	locs := rulesHeaderRegexp.FindAllStringIndex(l.text, n+1)
+	if len(locs) <= n {
+		return 0
+	}
+
+	l.matcherCursor = locs[n][1]
+	return l.lineAt(locs[n][1])
+}
+
+func (l *locator) command(name string) int {
+	return l.find(regexp.MustCompile(`command\.("?)` + regexp.QuoteMeta(name) + `("?)(\s*\]|\.cmd\s*=)`))
+}
+
+// matcher returns the line of the next matcher of the type after the current
+// rule or previously located matcher
+func (l *locator) matcher(matcherType string) int {
+	re := regexp.MustCompile(`type\s*=\s*["']` + regexp.QuoteMeta(matcherType) + `["']`)
+	line, end := l.findFrom(l.matcherCursor, re)
+	l.matcherCursor = end
+	return line
+}
+
+// key returns the line of the next occurrence of the key, repeated lookups of
+// the same key return subsequent occurrences
+func (l *locator) key(key toml.Key) int {
+	name := key[len(key)-1]
+	re := regexp.MustCompile(`(^|[\s{,.\[])("?)` + regexp.QuoteMeta(name) + `("?)\s*(=|\])`)
+
+	line, end := l.findFrom(l.keyCursors[key.String()], re)
+	l.keyCursors[key.String()] = end
+	return line
+}
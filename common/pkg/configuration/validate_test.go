@@ -0,0 +1,248 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+type regexMatcher struct {
+	regex *regexp.Regexp
+}
+
+func (m regexMatcher) Match(req *matchers.Request) (bool, error) {
+	return m.regex.MatchString(req.RawURL), nil
+}
+
+type regexMatcherFactory struct{}
+
+func (regexMatcherFactory) Compile(configProvider matchers.MatcherConfigProvider) (matchers.Matcher, error) {
+	var c struct {
+		Regex string `toml:"regex"`
+	}
+	if err := configProvider(&c); err != nil {
+		return nil, err
+	}
+
+	regex, err := regexp.Compile(c.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %w", err)
+	}
+	return regexMatcher{regex: regex}, nil
+}
+
+// TestValidate tests strict validation of configuration
+func TestValidate(t *testing.T) {
+	r := matchers.NewMatcherRegistry()
+	r.RegisterMatcher("re", regexMatcherFactory{})
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "valid config",
+			input: `
+default_command = "open"
+
+[command.open]
+cmd = "firefox {}"
+
+[[rules]]
+command = "open"
+matchers = [{ type = "any", matchers = [{ type = "re", regex = "jira" }] }]
+`,
+		},
+		{
+			name: "syntax error",
+			input: `
+default_command = = "open"
+`,
+			want: []string{"2: error"},
+		},
+		{
+			name: "command problems",
+			input: `
+# personal browser
+default_command = "firefox"
+
+[command.empty]
+cmd = []
+
+[command.noplaceholder]
+cmd = "firefox"
+`,
+			want: []string{
+				`3: warning: default_command "firefox" is not declared`,
+				`5: error: command "empty" has empty cmd`,
+				`8: error: command "noplaceholder" contains neither placeholder "{}"`,
+			},
+		},
+		{
+			name: "rule problems",
+			input: `
+default_command = "open"
+
+[command.open]
+cmd = "firefox {}"
+
+[[rules]]
+command = "missing"
+[[rules.matchers]]
+type = "re"
+regex = "("
+[[rules.matchers]]
+type = "unknown"
+foo = "bar"
+
+[[rules]]
+command = "open"
+matchers = [{ type = "re", regex = "ok" }, { type = "not", matchers = [{ type = "re", regx = "(" }] }]
+`,
+			want: []string{
+				`7: warning: rule 0 refers to undeclared command "missing"`,
+				"10: error: rule 0, matcher 0: invalid regex",
+				"13: error: rule 0, matcher 1: unknown matcher unknown",
+				"18: error: unknown key rules.matchers.matchers.regx",
+			},
+		},
+		{
+			name: "ask command",
+			input: `
+default_command = "ask"
+
+[command.ask]
+type = "ask"
+cmd = "fuzzel --dmenu"
+choices = ["open", "missing", "other"]
+default = "personal"
+
+[command.other]
+type = "ask"
+cmd = "rofi -dmenu"
+
+[command.open]
+cmd = "firefox {}"
+`,
+			want: []string{
+				`4: error: command "ask" offers undeclared command "missing"`,
+				`4: error: command "ask" offers ask command "other"`,
+				`4: error: default "personal" of command "ask" is not one of its choices`,
+			},
+		},
+		{
+			name: "fallback",
+			input: `
+default_command = "open"
+
+[command.open]
+cmd = "firefox {}"
+fallback = ["missing"]
+launch_timeout = "-1s"
+
+[command.ask]
+type = "ask"
+cmd = "fuzzel --dmenu"
+
+[[rules]]
+command = "open"
+fallback = ["ask"]
+`,
+			want: []string{
+				`4: warning: command "open" falls back to undeclared command "missing"`,
+				`4: error: launch_timeout of command "open" is negative`,
+				`13: error: rule 0 falls back to ask command "ask"`,
+			},
+		},
+		{
+			name: "provider error policy",
+			input: `
+default_command = "open"
+on_provider_error = "fail_rule"
+fallback_command = "chooser"
+
+[command.open]
+cmd = "firefox {}"
+`,
+			want: []string{
+				`4: warning: fallback_command is used with on_provider_error = "fail" only`,
+			},
+		},
+		{
+			name: "fail policy without fallback",
+			input: `
+default_command = "open"
+on_provider_error = "fail"
+
+[command.open]
+cmd = "firefox {}"
+`,
+			want: []string{
+				"3: warning: fallback_command is not set",
+			},
+		},
+		{
+			name: "unknown keys",
+			input: `
+default_command = "open"
+defualt = "x"
+
+[command.open]
+cmd = "firefox {}"
+qeury_escape = true
+
+[comand.other]
+cmd = "chromium {}"
+`,
+			want: []string{
+				"3: error: unknown key defualt",
+				"7: error: unknown key command.open.qeury_escape",
+				"9: error: unknown key comand.other",
+			},
+		},
+		{
+			name: "template fields",
+			input: `
+default_command = "shell"
+
+[command.shell]
+cmd = ["sh", "-c", "firefox --profile ${HOME}/p \"$0\" {original_url}", "{}"]
+
+[command.typo]
+cmd = "firefox {hostnme}"
+
+[command.awk]
+cmd = ["awk", "{print}", "{url}"]
+`,
+			want: []string{
+				`7: warning: command "typo" has unknown template fields ["{hostnme}"]`,
+				`7: error: command "typo" contains neither placeholder "{}"`,
+				`10: warning: command "awk" has unknown template fields ["{print}"]`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := Validate(tt.input, r)
+
+			got := make([]string, len(issues))
+			for i, issue := range issues {
+				got[i] = fmt.Sprintf("%d: %s: %s", issue.Line, issue.Severity, issue.Message)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Validate() issues = %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if !strings.HasPrefix(got[i], tt.want[i]) {
+					t.Errorf("Validate() issue %d = %q, want prefix %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
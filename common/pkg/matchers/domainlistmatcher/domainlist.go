@@ -0,0 +1,262 @@
+// Package domainlistmatcher matches URL hosts against domain lists loaded from
+// files.
+//
+// Every non-empty line of a file is one of:
+//
+//	example.com      the exact host
+//	*.example.com    any subdomain, but not example.com itself
+//	.example.com     example.com and any of its subdomains
+//	||example.com^   adblock style, same as .example.com
+//
+// Lines starting with "#" or "!" are comments. Adblock options after "^" are
+// ignored, unsupported adblock rules (exceptions, paths, regexes) are skipped.
+package domainlistmatcher
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+type entryKind uint8
+
+const (
+	exact entryKind = 1 << iota
+	subdomains
+)
+
+type domainListMatcherFactory struct {
+	// baseDir is the config file directory, relative paths are resolved
+	// against it
+	baseDir string
+}
+
+type domainListMatcherConfig struct {
+	File  string   `toml:"file,omitempty"`
+	Files []string `toml:"files,omitempty"`
+	// Original matches the URL before unwrapping and rewrites
+	Original bool `toml:"original,omitempty"`
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+type domainListMatcher struct {
+	files    []string
+	original bool
+
+	mu      sync.Mutex
+	states  []fileState
+	domains map[string]entryKind
+}
+
+// Compile implements matchers.Factory.
+func (f domainListMatcherFactory) Compile(configProvider matchers.MatcherConfigProvider) (matchers.Matcher, error) {
+	var c domainListMatcherConfig
+	if err := configProvider(&c); err != nil {
+		return nil, fmt.Errorf("failed to load domain_list matcher config: %w", err)
+	}
+
+	files := c.Files
+	if c.File != "" {
+		files = append([]string{c.File}, files...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("at least one file is required")
+	}
+
+	m := &domainListMatcher{original: c.Original}
+	for _, file := range files {
+		m.files = append(m.files, f.expandPath(file))
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Match implements matchers.Matcher.
+func (m *domainListMatcher) Match(req *matchers.Request) (bool, error) {
+	url := req.URL
+	if m.original {
+		url = req.OriginalURL
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The last loaded lists are used while a file can't be read, e.g. during
+	// an atomic save of the file
+	if err := m.reloadIfChanged(); err != nil {
+		if m.domains == nil {
+			return false, err
+		}
+		slog.Warn("Failed to reload domain list, keeping the previous one", "err", err)
+	}
+
+	return m.lookup(strings.ToLower(url.Hostname())), nil
+}
+
+// lookup checks the host itself and then each of its parent domains
+func (m *domainListMatcher) lookup(host string) bool {
+	if host == "" {
+		return false
+	}
+
+	if m.domains[host]&exact != 0 {
+		return true
+	}
+
+	for domain := host; ; {
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			return false
+		}
+		if m.domains[parent]&subdomains != 0 {
+			return true
+		}
+		domain = parent
+	}
+}
+
+func (m *domainListMatcher) reloadIfChanged() error {
+	for i, file := range m.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("failed to stat domain list: %w", err)
+		}
+
+		if info.ModTime() != m.states[i].modTime || info.Size() != m.states[i].size {
+			slog.Debug("Domain list changed, reloading", "file", file)
+			return m.load()
+		}
+	}
+	return nil
+}
+
+func (m *domainListMatcher) load() error {
+	domains := map[string]entryKind{}
+	states := make([]fileState, len(m.files))
+
+	for i, file := range m.files {
+		state, err := loadFile(file, domains)
+		if err != nil {
+			return err
+		}
+		states[i] = state
+	}
+
+	m.domains = domains
+	m.states = states
+	return nil
+}
+
+func loadFile(path string, domains map[string]entryKind) (fileState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileState{}, fmt.Errorf("failed to open domain list: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileState{}, fmt.Errorf("failed to stat domain list: %w", err)
+	}
+
+	scanner := bufio.NewScanner(f)
+	for lineN := 1; scanner.Scan(); lineN++ {
+		domain, kind, ok := parseLine(scanner.Text())
+		if !ok {
+			slog.Debug("Skipping unsupported domain list line", "file", path, "line", lineN)
+			continue
+		}
+		if domain != "" {
+			domains[domain] |= kind
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fileState{}, fmt.Errorf("failed to read domain list %s: %w", path, err)
+	}
+
+	return fileState{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// parseLine returns the domain and its kind, empty domain is returned for
+// blank and comment lines, ok is false for unsupported lines
+func parseLine(line string) (string, entryKind, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+		return "", 0, true
+	}
+
+	var kind entryKind
+	switch {
+	case strings.HasPrefix(line, "||"):
+		domain, _, ok := strings.Cut(line[2:], "^")
+		if !ok {
+			return "", 0, false
+		}
+		line, kind = domain, exact|subdomains
+	case strings.HasPrefix(line, "*."):
+		line, kind = line[2:], subdomains
+	case strings.HasPrefix(line, "."):
+		line, kind = line[1:], exact|subdomains
+	default:
+		kind = exact
+	}
+
+	line = strings.ToLower(line)
+	if !validDomain(line) {
+		return "", 0, false
+	}
+
+	return line, kind, true
+}
+
+func validDomain(domain string) bool {
+	if domain == "" || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return false
+	}
+	for _, r := range domain {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// expandPath expands environment variables and leading "~/", relative path is
+// resolved against the config file directory
+func (f domainListMatcherFactory) expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(f.baseDir, path)
+	}
+	return path
+}
+
+var _ matchers.Factory = domainListMatcherFactory{}
+var _ matchers.Matcher = &domainListMatcher{}
+
+// New returns the factory resolving relative list paths against configDir
+func New(configDir string) matchers.Factory {
+	return domainListMatcherFactory{baseDir: configDir}
+}
@@ -0,0 +1,174 @@
+package domainlistmatcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/matchers/matcherstest"
+)
+
+func compile(t *testing.T, config string) (matchers.Matcher, error) {
+	t.Helper()
+	return compileIn(t, "", config)
+}
+
+// compileIn compiles the matcher with config file placed in configDir
+func compileIn(t *testing.T, configDir string, config string) (matchers.Matcher, error) {
+	t.Helper()
+	return matcherstest.Compile(t, New(configDir), config)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const list = `# work domains
+corp.example
+*.internal.example
+.partner.example
+||adblock.example^
+||options.example^$third-party
+@@||exception.example^
+||path.example/ads
+UPPER.Example
+
+! adblock comment
+`
+
+func TestDomainListMatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "domains.txt")
+	writeFile(t, path, list)
+
+	m, err := compile(t, `file = "`+path+`"`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://corp.example/path", true},
+		{"https://CORP.example:8443/", true},
+		{"https://sub.corp.example/", false},
+		{"https://internal.example/", false},
+		{"https://a.internal.example/", true},
+		{"https://a.b.internal.example/", true},
+		{"https://partner.example/", true},
+		{"https://a.partner.example/", true},
+		{"https://badpartner.example/", false},
+		{"https://adblock.example/", true},
+		{"https://x.adblock.example/", true},
+		{"https://options.example/", true},
+		{"https://exception.example/", false},
+		{"https://path.example/", false},
+		{"https://upper.example/", true},
+		{"https://other.example/", false},
+		{"mailto:someone", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := m.Match(matchers.NewRequest(tt.url))
+			if err != nil {
+				t.Fatalf("Match() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainListMatcherMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFile(t, a, "a.example\n")
+	writeFile(t, b, "b.example\n")
+
+	m, err := compile(t, `file = "`+a+`", files = ["`+b+`"]`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	for _, url := range []string{"https://a.example", "https://b.example"} {
+		if ok, err := m.Match(matchers.NewRequest(url)); !ok || err != nil {
+			t.Errorf("Match(%s) = %v, %v, want true", url, ok, err)
+		}
+	}
+}
+
+func TestDomainListMatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	writeFile(t, path, "old.example\n")
+
+	m, err := compile(t, `file = "`+path+`"`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	writeFile(t, path, "new.example\n")
+	// Make sure the change is visible even on filesystems with coarse mtime
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := m.Match(matchers.NewRequest("https://new.example")); !ok {
+		t.Errorf("new domain did not match after reload")
+	}
+	if ok, _ := m.Match(matchers.NewRequest("https://old.example")); ok {
+		t.Errorf("old domain matched after reload")
+	}
+
+	// Lists loaded last time are kept while the file is missing
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := m.Match(matchers.NewRequest("https://new.example")); !ok || err != nil {
+		t.Errorf("Match() with removed file = %v, %v, want true", ok, err)
+	}
+
+	writeFile(t, path, "newer.example\n")
+	if ok, _ := m.Match(matchers.NewRequest("https://newer.example")); !ok {
+		t.Errorf("new domain did not match after file is back")
+	}
+}
+
+func TestDomainListMatcherRelativePath(t *testing.T) {
+	configDir := t.TempDir()
+	writeFile(t, filepath.Join(configDir, "domains.txt"), "work.example\n")
+
+	// Working directory does not matter, the path is relative to the config
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	m, err := compileIn(t, configDir, `file = "domains.txt"`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	if ok, err := m.Match(matchers.NewRequest("https://work.example")); !ok || err != nil {
+		t.Errorf("Match() = %v, %v, want true", ok, err)
+	}
+}
+
+func TestDomainListMatcherInvalidConfig(t *testing.T) {
+	for _, config := range []string{``, `file = "/nonexistent/domains.txt"`, `files = 1`} {
+		if _, err := compile(t, config); err == nil {
+			t.Errorf("Compile(%s) did not return error", config)
+		}
+	}
+}
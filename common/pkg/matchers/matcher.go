@@ -2,33 +2,142 @@ package matchers
 
 import (
 	"fmt"
+	"log/slog"
+	neturl "net/url"
+	"slices"
+	"strings"
 )
 
 type MatcherConfigProvider func(v any) error
 
+// Request describes the link being dispatched, it is passed to every matcher
+type Request struct {
+	// RawURL is the URL after unwrapping and rewrites, it is used to match
+	// and to launch the command
+	RawURL string
+	URL    *neturl.URL
+
+	// OriginalURL is the URL autobrowser was called with
+	OriginalRawURL string
+	OriginalURL    *neturl.URL
+}
+
+func NewRequest(rawURL string) *Request {
+	url := parseURL(rawURL)
+
+	return &Request{
+		RawURL:         rawURL,
+		URL:            url,
+		OriginalRawURL: rawURL,
+		OriginalURL:    url,
+	}
+}
+
+// WithURL returns copy of the request with the URL replaced and the original
+// one kept
+func (r *Request) WithURL(rawURL string) *Request {
+	result := *r
+	result.RawURL = rawURL
+	result.URL = parseURL(rawURL)
+	return &result
+}
+
+func parseURL(rawURL string) *neturl.URL {
+	url, err := neturl.Parse(rawURL)
+	if err != nil {
+		slog.Error("Failed to prase URL, non-regex rules will not work!", "err", err)
+		return &neturl.URL{}
+	}
+	return url
+}
+
+// Matcher is a compiled matcher ready to be evaluated against requests
 type Matcher interface {
-	Match(configProvider MatcherConfigProvider) (bool, error)
+	Match(req *Request) (bool, error)
+}
+
+// ProviderError is returned by matchers failed to get the request context
+// from a provider, e.g. the active window from the desktop environment. The
+// config decides whether it fails the evaluation.
+type ProviderError struct {
+	Provider string
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s provider failed: %s", e.Provider, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Factory compiles matcher configuration into a Matcher once the config is
+// loaded, invalid configuration must be reported as an error. Factory should
+// decode the whole config to let unknown keys be detected.
+type Factory interface {
+	Compile(configProvider MatcherConfigProvider) (Matcher, error)
+}
+
+// FieldProvider is implemented by matcher factories exposing values to
+// command templates, e.g. factory registered as "app" resolves {app.class}
+type FieldProvider interface {
+	Field(name string) (string, bool)
+	// FieldNames lists names of resolved fields, they are checked when
+	// the config is loaded
+	FieldNames() []string
 }
 
 type MatchersRegistry struct {
-	matchers map[string]Matcher
+	matchers map[string]Factory
 }
 
 func NewMatcherRegistry() *MatchersRegistry {
 	return &MatchersRegistry{
-		matchers: map[string]Matcher{},
+		matchers: map[string]Factory{},
 	}
 }
 
-func (r *MatchersRegistry) RegisterMatcher(name string, matcher Matcher) {
-	r.matchers[name] = matcher
+func (r *MatchersRegistry) RegisterMatcher(name string, factory Factory) {
+	r.matchers[name] = factory
 }
 
-func (r *MatchersRegistry) GetMatcher(name string) (Matcher, error) {
-	matcher, ok := r.matchers[name]
+// Compile compiles config of the matcher registered with the name
+func (r *MatchersRegistry) Compile(name string, configProvider MatcherConfigProvider) (Matcher, error) {
+	factory, ok := r.matchers[name]
 	if !ok {
 		return nil, fmt.Errorf("unknown matcher %s", name)
 	}
 
-	return matcher, nil
+	return factory.Compile(configProvider)
+}
+
+// Field resolves template field "<matcher>.<name>" using the matcher factory
+// registered with the name
+func (r *MatchersRegistry) Field(key string) (string, bool) {
+	name, field, ok := strings.Cut(key, ".")
+	if !ok {
+		return "", false
+	}
+
+	provider, ok := r.matchers[name].(FieldProvider)
+	if !ok {
+		return "", false
+	}
+
+	return provider.Field(field)
+}
+
+// HasField reports whether template field "<matcher>.<name>" is resolved by
+// the matcher factory registered with the name
+func (r *MatchersRegistry) HasField(key string) bool {
+	name, field, ok := strings.Cut(key, ".")
+	if !ok {
+		return false
+	}
+	provider, ok := r.matchers[name].(FieldProvider)
+	if !ok {
+		return false
+	}
+	return slices.Contains(provider.FieldNames(), field)
 }
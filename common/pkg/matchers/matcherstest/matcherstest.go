@@ -0,0 +1,23 @@
+// Package matcherstest provides utilities for matcher tests.
+package matcherstest
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+)
+
+// Compile compiles a matcher with factory from config, given as the body of an
+// inline toml table, e.g. `host = "example.com"`
+func Compile(t testing.TB, factory matchers.Factory, config string) (matchers.Matcher, error) {
+	t.Helper()
+
+	var c map[string]toml.Primitive
+	md, err := toml.Decode("m = {"+config+"}", &c)
+	if err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+
+	return factory.Compile(func(v any) error { return md.PrimitiveDecode(c["m"], v) })
+}
@@ -2,72 +2,223 @@ package urlmatcher
 
 import (
 	"fmt"
-	"log/slog"
 	neturl "net/url"
+	"path"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/pltanton/autobrowser/common/pkg/matchers"
 )
 
+type urlMatcherFactory struct{}
+
+// check reports whether the parsed URL satisfies a single matcher property
+type check func(u *neturl.URL) bool
+
 type urlMatcher struct {
-	rawURL string
-	url    *neturl.URL
+	regex    *regexp.Regexp
+	checks   []check
+	original bool
 }
 
+// urlMatcherConfig properties are combined with AND, list-valued properties
+// and their singular variants match if any of values matches
 type urlMatcherConfig struct {
-	Regex  string `toml:"regex,omitempty"`
-	Host   string `toml:"host,omitempty"`
-	Scheme string `toml:"scheme,omitempty"`
+	Regex string `toml:"regex,omitempty"`
+
+	Host         string   `toml:"host,omitempty"`
+	Hosts        []string `toml:"hosts,omitempty"`
+	HostGlob     string   `toml:"host_glob,omitempty"`
+	HostGlobs    []string `toml:"host_globs,omitempty"`
+	HostSuffix   string   `toml:"host_suffix,omitempty"`
+	HostSuffixes []string `toml:"host_suffixes,omitempty"`
+
+	Scheme  string   `toml:"scheme,omitempty"`
+	Schemes []string `toml:"schemes,omitempty"`
+	Port    int      `toml:"port,omitempty"`
+	Ports   []int    `toml:"ports,omitempty"`
+
+	Path         string   `toml:"path,omitempty"`
+	Paths        []string `toml:"paths,omitempty"`
+	PathPrefix   string   `toml:"path_prefix,omitempty"`
+	PathPrefixes []string `toml:"path_prefixes,omitempty"`
+	PathGlob     string   `toml:"path_glob,omitempty"`
+	PathGlobs    []string `toml:"path_globs,omitempty"`
+
+	// Query maps parameter names to glob patterns of their values, "*"
+	// requires the parameter to be present
+	Query map[string]string `toml:"query,omitempty"`
+	// UserInfo requires user info to be present or absent in the URL
+	UserInfo *bool `toml:"userinfo,omitempty"`
+
+	// Original matches the URL before unwrapping and rewrites
+	Original bool `toml:"original,omitempty"`
 }
 
-// Match implements matchers.Matcher.
-func (u *urlMatcher) Match(configProvider matchers.MatcherConfigProvider) (bool, error) {
+// Compile implements matchers.Factory.
+func (urlMatcherFactory) Compile(configProvider matchers.MatcherConfigProvider) (matchers.Matcher, error) {
 	var c urlMatcherConfig
 	if err := configProvider(&c); err != nil {
-		return false, fmt.Errorf("failed to load url matcher config %w", err)
+		return nil, fmt.Errorf("failed to load url matcher config %w", err)
 	}
 
-	if c.Regex != "" && !u.matchByRegex(c.Regex) {
-		return false, nil
+	m := &urlMatcher{
+		original: c.Original,
 	}
 
-	if c.Host != "" && !u.matchByHost(c.Host) {
-		return false, nil
+	if c.Regex != "" {
+		var err error
+		if m.regex, err = regexp.Compile(c.Regex); err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
 	}
 
-	if c.Scheme != "" && !u.matchByScheme(c.Scheme) {
+	for _, globs := range [][]string{c.HostGlobs, c.PathGlobs, {c.HostGlob, c.PathGlob}} {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+			}
+		}
+	}
+	for name, glob := range c.Query {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q for query parameter %q: %w", glob, name, err)
+		}
+	}
+
+	addCheck(m, values(c.Host, c.Hosts), matchHost)
+	addCheck(m, values(c.HostGlob, c.HostGlobs), func(u *neturl.URL, glob string) bool {
+		ok, _ := path.Match(strings.ToLower(glob), strings.ToLower(u.Hostname()))
+		return ok
+	})
+	addCheck(m, values(c.HostSuffix, c.HostSuffixes), matchHostSuffix)
+	addCheck(m, values(c.Scheme, c.Schemes), func(u *neturl.URL, scheme string) bool {
+		return strings.EqualFold(u.Scheme, scheme)
+	})
+	addCheck(m, values(c.Port, c.Ports), func(u *neturl.URL, port int) bool {
+		return urlPort(u) == port
+	})
+	addCheck(m, values(c.Path, c.Paths), func(u *neturl.URL, p string) bool {
+		return u.Path == p
+	})
+	addCheck(m, values(c.PathPrefix, c.PathPrefixes), func(u *neturl.URL, prefix string) bool {
+		return strings.HasPrefix(u.Path, prefix)
+	})
+	addCheck(m, values(c.PathGlob, c.PathGlobs), func(u *neturl.URL, glob string) bool {
+		ok, _ := path.Match(glob, u.Path)
+		return ok
+	})
+
+	if len(c.Query) > 0 {
+		m.checks = append(m.checks, func(u *neturl.URL) bool {
+			return matchQuery(u.Query(), c.Query)
+		})
+	}
+
+	if c.UserInfo != nil {
+		userInfo := *c.UserInfo
+		m.checks = append(m.checks, func(u *neturl.URL) bool {
+			return (u.User != nil) == userInfo
+		})
+	}
+
+	return m, nil
+}
+
+// Match implements matchers.Matcher.
+func (u *urlMatcher) Match(req *matchers.Request) (bool, error) {
+	rawURL, url := req.RawURL, req.URL
+	if u.original {
+		rawURL, url = req.OriginalRawURL, req.OriginalURL
+	}
+
+	if u.regex != nil && !u.regex.MatchString(rawURL) {
 		return false, nil
 	}
 
+	for _, check := range u.checks {
+		if !check(url) {
+			return false, nil
+		}
+	}
+
 	return true, nil
 }
 
-func (u *urlMatcher) matchByHost(host string) bool {
-	return u.url.Host == host
-}
+// addCheck adds check passing if any of values matches, empty values are
+// ignored
+func addCheck[T comparable](m *urlMatcher, vs []T, match func(*neturl.URL, T) bool) {
+	if len(vs) == 0 {
+		return
+	}
 
-func (u *urlMatcher) matchByScheme(scheme string) bool {
-	return u.url.Scheme == scheme
+	m.checks = append(m.checks, func(u *neturl.URL) bool {
+		return slices.ContainsFunc(vs, func(v T) bool { return match(u, v) })
+	})
 }
 
-func (u *urlMatcher) matchByRegex(regex string) bool {
-	r, err := regexp.Compile(regex)
-	if err != nil {
-		slog.Error(fmt.Sprintf("failed to compile regex '%s'", regex), "err", err)
+// values merges singular and list-valued variants of the property
+func values[T comparable](v T, vs []T) []T {
+	var zero T
+	if v == zero {
+		return vs
 	}
-	return r.Match([]byte(u.rawURL))
+	return append([]T{v}, vs...)
 }
 
-var _ matchers.Matcher = &urlMatcher{}
+// matchHost matches host with or without port
+func matchHost(u *neturl.URL, host string) bool {
+	return strings.EqualFold(u.Host, host) || strings.EqualFold(u.Hostname(), host)
+}
 
-func New(url string) matchers.Matcher {
-	netUrl, err := neturl.Parse(url)
-	if err != nil {
-		slog.Error("Failed to prase URL, non-regex rules will not work!", "err", err)
+// matchHostSuffix matches the domain and its subdomains, so "example.com"
+// matches "a.example.com" but not "badexample.com"
+func matchHostSuffix(u *neturl.URL, suffix string) bool {
+	host := strings.ToLower(u.Hostname())
+	suffix = strings.ToLower(strings.TrimPrefix(suffix, "."))
+	return host == suffix || strings.HasSuffix(host, "."+suffix)
+}
+
+// urlPort returns explicit port of the URL or the default one of the scheme
+func urlPort(u *neturl.URL) int {
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		return port
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "ws":
+		return 80
+	case "https", "wss":
+		return 443
+	case "ftp":
+		return 21
 	}
+	return 0
+}
+
+func matchQuery(query neturl.Values, patterns map[string]string) bool {
+	for name, glob := range patterns {
+		vs, ok := query[name]
+		if !ok {
+			return false
+		}
 
-	return &urlMatcher{
-		rawURL: url,
-		url:    netUrl,
+		matched := slices.ContainsFunc(vs, func(v string) bool {
+			ok, _ := path.Match(glob, v)
+			return ok
+		})
+		if !matched {
+			return false
+		}
 	}
+	return true
+}
+
+var _ matchers.Factory = urlMatcherFactory{}
+var _ matchers.Matcher = &urlMatcher{}
+
+func New() matchers.Factory {
+	return urlMatcherFactory{}
 }
@@ -0,0 +1,73 @@
+// Package notify describes desktop notifications about routing decisions and
+// failures, platforms provide the Notifier showing them
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultTimeout is how long notifications with actions wait for the user
+const DefaultTimeout = 10 * time.Second
+
+type Config struct {
+	// Failures notifies about config errors and commands failed to launch,
+	// enabled by default
+	Failures *bool `toml:"failures,omitempty"`
+	// Decisions notifies about every routing decision
+	Decisions bool `toml:"decisions,omitempty"`
+	// Timeout is how long notifications stay and wait for actions
+	Timeout time.Duration `toml:"timeout,omitempty"`
+}
+
+func (c Config) Validate() error {
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
+
+// NotifyFailures reports whether failures should be notified
+func (c Config) NotifyFailures() bool {
+	return c.Failures == nil || *c.Failures
+}
+
+// WaitTimeout returns configured timeout or the default one
+func (c Config) WaitTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+type Urgency byte
+
+// Urgency levels defined by the desktop notifications specification
+const (
+	UrgencyLow Urgency = iota
+	UrgencyNormal
+	UrgencyCritical
+)
+
+type Notification struct {
+	Summary string
+	Body    string
+	Urgency Urgency
+	Actions []Action
+	// Timeout is how long the notification is shown, and with actions how
+	// long Notify waits for the user
+	Timeout time.Duration
+}
+
+// Action is a button of the notification
+type Action struct {
+	Key   string
+	Label string
+}
+
+type Notifier interface {
+	// Notify shows the notification. With actions it blocks until the user
+	// invokes one, dismisses the notification or the timeout passes, and
+	// returns the key of the invoked action or empty string.
+	Notify(n Notification) (string, error)
+}
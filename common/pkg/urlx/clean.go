@@ -0,0 +1,105 @@
+package urlx
+
+import (
+	neturl "net/url"
+	"slices"
+	"strings"
+)
+
+// DefaultTrackingParams are query parameters removed by the cleaner, trailing
+// "*" matches any suffix
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"gclsrc",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"msclkid",
+	"yclid",
+	"twclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmi",
+	"mkt_tok",
+	"oly_anon_id",
+	"oly_enc_id",
+	"vero_id",
+}
+
+// CleanConfig configures the [clean] section
+type CleanConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Params are removed in addition to the default ones
+	Params []string `toml:"params,omitempty"`
+	// Keep lists params never removed, even if they are in the default list
+	Keep []string `toml:"keep,omitempty"`
+}
+
+// Cleaner removes tracking query parameters from URLs
+type Cleaner struct {
+	params []string
+	keep   []string
+}
+
+func NewCleaner(c CleanConfig) *Cleaner {
+	return &Cleaner{
+		params: append(slices.Clone(DefaultTrackingParams), c.Params...),
+		keep:   c.Keep,
+	}
+}
+
+// Clean returns the URL without tracking parameters and names of removed
+// ones, order and encoding of other parameters are kept as is
+func (c *Cleaner) Clean(rawURL string) (string, []string) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL, nil
+	}
+
+	var kept []string
+	var removed []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := neturl.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+
+		if key != "" && c.shouldRemove(key) {
+			removed = append(removed, key)
+			continue
+		}
+		kept = append(kept, pair)
+	}
+
+	if len(removed) == 0 {
+		return rawURL, nil
+	}
+
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String(), removed
+}
+
+func (c *Cleaner) shouldRemove(key string) bool {
+	if matchParam(c.keep, key) {
+		return false
+	}
+	return matchParam(c.params, key)
+}
+
+func matchParam(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
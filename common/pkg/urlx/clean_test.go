@@ -0,0 +1,89 @@
+package urlx
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CleanConfig
+		url         string
+		want        string
+		wantRemoved []string
+	}{
+		{
+			name: "no query",
+			url:  "https://example.com/path",
+			want: "https://example.com/path",
+		},
+		{
+			name: "nothing to remove",
+			url:  "https://example.com/?b=2&a=1",
+			want: "https://example.com/?b=2&a=1",
+		},
+		{
+			name:        "utm params",
+			url:         "https://example.com/?utm_source=x&id=1&utm_medium=email&utm_campaign=y",
+			want:        "https://example.com/?id=1",
+			wantRemoved: []string{"utm_source", "utm_medium", "utm_campaign"},
+		},
+		{
+			name:        "click ids",
+			url:         "https://example.com/?fbclid=1&gclid=2&mc_eid=3",
+			want:        "https://example.com/",
+			wantRemoved: []string{"fbclid", "gclid", "mc_eid"},
+		},
+		{
+			name:        "order and encoding kept",
+			url:         "https://example.com/?q=a%20b&fbclid=1&z=%2F&a",
+			want:        "https://example.com/?q=a%20b&z=%2F&a",
+			wantRemoved: []string{"fbclid"},
+		},
+		{
+			name:        "fragment kept",
+			url:         "https://example.com/p?gclid=1#section",
+			want:        "https://example.com/p#section",
+			wantRemoved: []string{"gclid"},
+		},
+		{
+			name:        "encoded key",
+			url:         "https://example.com/?utm%5Fsource=x",
+			want:        "https://example.com/",
+			wantRemoved: []string{"utm_source"},
+		},
+		{
+			name:        "custom params",
+			config:      CleanConfig{Params: []string{"ref", "si_*"}},
+			url:         "https://example.com/?ref=hn&si_id=1&sid=2",
+			want:        "https://example.com/?sid=2",
+			wantRemoved: []string{"ref", "si_id"},
+		},
+		{
+			name:        "kept params",
+			config:      CleanConfig{Keep: []string{"utm_source"}},
+			url:         "https://example.com/?utm_source=x&utm_medium=y",
+			want:        "https://example.com/?utm_source=x",
+			wantRemoved: []string{"utm_medium"},
+		},
+		{
+			name:        "similar names are not removed",
+			url:         "https://example.com/?xfbclid=1&gclid_x=2&utm=3&gclid=4",
+			want:        "https://example.com/?xfbclid=1&gclid_x=2&utm=3",
+			wantRemoved: []string{"gclid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed := NewCleaner(tt.config).Clean(tt.url)
+			if got != tt.want {
+				t.Errorf("Clean() = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(removed, tt.wantRemoved) {
+				t.Errorf("Clean() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
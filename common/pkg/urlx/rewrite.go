@@ -0,0 +1,123 @@
+// Package urlx transforms URLs before they are matched and dispatched
+package urlx
+
+import (
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// RewriteConfig describes a single [[rewrites]] entry. It either replaces
+// the part of the URL matched by regex with the template referring capture
+// groups ($1, ${name}), or edits parts of the URL with matching host and path
+// prefix.
+type RewriteConfig struct {
+	Regex   string `toml:"regex,omitempty"`
+	Replace string `toml:"replace,omitempty"`
+
+	Host          string `toml:"host,omitempty"`
+	PathPrefix    string `toml:"path_prefix,omitempty"`
+	SetScheme     string `toml:"set_scheme,omitempty"`
+	SetHost       string `toml:"set_host,omitempty"`
+	SetPathPrefix string `toml:"set_path_prefix,omitempty"`
+}
+
+func (c RewriteConfig) isStructured() bool {
+	return c.Host != "" || c.PathPrefix != "" || c.SetScheme != "" || c.SetHost != "" || c.SetPathPrefix != ""
+}
+
+type rewrite struct {
+	config RewriteConfig
+	regex  *regexp.Regexp
+}
+
+// Rewriter applies rewrites in order, each one to the result of previous
+type Rewriter struct {
+	rewrites []rewrite
+}
+
+func NewRewriter(configs []RewriteConfig) (*Rewriter, error) {
+	r := &Rewriter{}
+
+	for i, c := range configs {
+		rw := rewrite{config: c}
+
+		switch {
+		case c.Regex != "" && c.isStructured():
+			return nil, fmt.Errorf("rewrite %d: regex can't be combined with structured edits", i)
+		case c.Regex != "":
+			var err error
+			if rw.regex, err = regexp.Compile(c.Regex); err != nil {
+				return nil, fmt.Errorf("rewrite %d: invalid regex: %w", i, err)
+			}
+		case c.Replace != "":
+			return nil, fmt.Errorf("rewrite %d: replace requires regex", i)
+		case c.SetScheme == "" && c.SetHost == "" && c.SetPathPrefix == "":
+			return nil, fmt.Errorf("rewrite %d: nothing to rewrite, set regex or any of set_scheme, set_host, set_path_prefix", i)
+		case c.SetPathPrefix != "" && c.PathPrefix == "":
+			return nil, fmt.Errorf("rewrite %d: set_path_prefix requires path_prefix", i)
+		}
+
+		r.rewrites = append(r.rewrites, rw)
+	}
+
+	return r, nil
+}
+
+// Rewrite returns the rewritten URL and indices of applied rewrites
+func (r *Rewriter) Rewrite(rawURL string) (string, []int) {
+	var applied []int
+
+	for i, rw := range r.rewrites {
+		result, ok := rw.apply(rawURL)
+		if ok {
+			rawURL = result
+			applied = append(applied, i)
+		}
+	}
+
+	return rawURL, applied
+}
+
+func (rw rewrite) apply(rawURL string) (string, bool) {
+	if rw.regex != nil {
+		match := rw.regex.FindStringSubmatchIndex(rawURL)
+		if match == nil {
+			return "", false
+		}
+
+		// Replace only the matched part, keeping the rest of the URL
+		var result []byte
+		result = append(result, rawURL[:match[0]]...)
+		result = rw.regex.ExpandString(result, rw.config.Replace, rawURL, match)
+		result = append(result, rawURL[match[1]:]...)
+		return string(result), true
+	}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	c := rw.config
+	if c.Host != "" && u.Host != c.Host {
+		return "", false
+	}
+	if c.PathPrefix != "" && !strings.HasPrefix(u.Path, c.PathPrefix) {
+		return "", false
+	}
+
+	if c.SetScheme != "" {
+		u.Scheme = c.SetScheme
+	}
+	if c.SetHost != "" {
+		u.Host = c.SetHost
+	}
+	if c.SetPathPrefix != "" {
+		u.Path = c.SetPathPrefix + strings.TrimPrefix(u.Path, c.PathPrefix)
+		u.RawPath = ""
+	}
+
+	return u.String(), true
+}
@@ -0,0 +1,63 @@
+package urlx
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	rewriter, err := NewRewriter([]RewriteConfig{
+		{Regex: `^https://(www\.)?twitter\.com/`, Replace: "https://nitter.net/"},
+		{Host: "reddit.com", SetHost: "old.reddit.com"},
+		{Regex: `^https://zoom\.us/j/(\d+)\?pwd=(\w+)$`, Replace: "zoommtg://zoom.us/join?confno=${1}&pwd=${2}"},
+		{Host: "github.com", PathPrefix: "/old-org/", SetPathPrefix: "/new-org/"},
+		{Host: "nitter.net", SetScheme: "http"},
+	})
+	if err != nil {
+		t.Fatalf("NewRewriter() error = %v", err)
+	}
+
+	tests := []struct {
+		url         string
+		want        string
+		wantApplied []int
+	}{
+		{"https://example.com/", "https://example.com/", nil},
+		{"https://twitter.com/user/status/1", "http://nitter.net/user/status/1", []int{0, 4}},
+		{"https://reddit.com/r/golang?sort=new", "https://old.reddit.com/r/golang?sort=new", []int{1}},
+		{"https://www.reddit.com/r/golang", "https://www.reddit.com/r/golang", nil},
+		{"https://zoom.us/j/123?pwd=x", "zoommtg://zoom.us/join?confno=123&pwd=x", []int{2}},
+		{"https://github.com/old-org/repo", "https://github.com/new-org/repo", []int{3}},
+		{"https://github.com/other/old-org/", "https://github.com/other/old-org/", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, applied := rewriter.Rewrite(tt.url)
+			if got != tt.want {
+				t.Errorf("Rewrite() = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(applied, tt.wantApplied) {
+				t.Errorf("Rewrite() applied = %v, want %v", applied, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestNewRewriterInvalid(t *testing.T) {
+	tests := map[string]RewriteConfig{
+		"invalid regex":            {Regex: "(", Replace: "x"},
+		"regex with edits":         {Regex: "x", SetHost: "y"},
+		"replace without regex":    {Replace: "x"},
+		"nothing to rewrite":       {Host: "x"},
+		"path prefix without cond": {Host: "x", SetPathPrefix: "/y"},
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewRewriter([]RewriteConfig{config}); err == nil {
+				t.Error("NewRewriter() did not return error")
+			}
+		})
+	}
+}
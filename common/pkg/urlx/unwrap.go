@@ -0,0 +1,131 @@
+package urlx
+
+import (
+	"fmt"
+	neturl "net/url"
+	"slices"
+	"strings"
+)
+
+const defaultUnwrapDepth = 5
+
+// WrapperConfig describes redirect URLs carrying the real destination in the
+// query parameter, e.g. https://www.google.com/url?q=<destination>
+type WrapperConfig struct {
+	Name string `toml:"name"`
+	// Host is matched exactly, "*.example.com" matches any subdomain
+	Host string `toml:"host"`
+	// Path is matched exactly if set
+	Path  string `toml:"path,omitempty"`
+	Param string `toml:"param"`
+}
+
+// UnwrapConfig configures the [unwrap] section
+type UnwrapConfig struct {
+	// Disable lists names of built-in wrappers to skip, "all" disables every
+	// built-in wrapper
+	Disable  []string        `toml:"disable,omitempty"`
+	MaxDepth int             `toml:"max_depth,omitempty"`
+	Wrappers []WrapperConfig `toml:"wrappers,omitempty"`
+}
+
+// BuiltinWrappers are known redirect services unwrapped by default
+var BuiltinWrappers = []WrapperConfig{
+	{Name: "outlook", Host: "*.safelinks.protection.outlook.com", Param: "url"},
+	{Name: "google", Host: "www.google.com", Path: "/url", Param: "q"},
+	{Name: "google", Host: "www.google.com", Path: "/url", Param: "url"},
+	{Name: "google", Host: "google.com", Path: "/url", Param: "q"},
+	{Name: "slack", Host: "slack-redir.net", Path: "/link", Param: "url"},
+	{Name: "facebook", Host: "l.facebook.com", Path: "/l.php", Param: "u"},
+	{Name: "facebook", Host: "lm.facebook.com", Path: "/l.php", Param: "u"},
+	{Name: "facebook", Host: "l.messenger.com", Path: "/l.php", Param: "u"},
+	{Name: "instagram", Host: "l.instagram.com", Path: "/", Param: "u"},
+	{Name: "youtube", Host: "www.youtube.com", Path: "/redirect", Param: "q"},
+	{Name: "steam", Host: "steamcommunity.com", Path: "/linkfilter/", Param: "url"},
+}
+
+// Unwrapper extracts destination URLs from known wrappers recursively
+type Unwrapper struct {
+	wrappers []WrapperConfig
+	maxDepth int
+}
+
+func NewUnwrapper(c UnwrapConfig) (*Unwrapper, error) {
+	u := &Unwrapper{maxDepth: c.MaxDepth}
+	if u.maxDepth == 0 {
+		u.maxDepth = defaultUnwrapDepth
+	}
+
+	if !slices.Contains(c.Disable, "all") {
+		for _, w := range BuiltinWrappers {
+			if !slices.Contains(c.Disable, w.Name) {
+				u.wrappers = append(u.wrappers, w)
+			}
+		}
+	}
+
+	wrappers := slices.Clone(c.Wrappers)
+	for i, w := range wrappers {
+		if w.Host == "" || w.Param == "" {
+			return nil, fmt.Errorf("wrapper %d: host and param are required", i)
+		}
+		if w.Name == "" {
+			wrappers[i].Name = w.Host
+		}
+	}
+
+	// User defined wrappers take precedence over built-in ones
+	u.wrappers = append(wrappers, u.wrappers...)
+	return u, nil
+}
+
+// Unwrap returns the destination URL and names of unwrapped wrappers
+func (u *Unwrapper) Unwrap(rawURL string) (string, []string) {
+	var unwrapped []string
+
+	for depth := 0; depth < u.maxDepth; depth++ {
+		parsed, err := neturl.Parse(rawURL)
+		if err != nil {
+			break
+		}
+
+		destination, name, ok := u.unwrapOnce(parsed)
+		if !ok {
+			break
+		}
+
+		rawURL = destination
+		unwrapped = append(unwrapped, name)
+	}
+
+	return rawURL, unwrapped
+}
+
+func (u *Unwrapper) unwrapOnce(parsed *neturl.URL) (string, string, bool) {
+	for _, w := range u.wrappers {
+		if !matchHost(parsed.Hostname(), w.Host) || (w.Path != "" && parsed.Path != w.Path) {
+			continue
+		}
+
+		destination := parsed.Query().Get(w.Param)
+		if destination == "" {
+			continue
+		}
+
+		// Only absolute URLs are considered to be a destination
+		if d, err := neturl.Parse(destination); err != nil || d.Scheme == "" || d.Host == "" {
+			continue
+		}
+
+		return destination, w.Name, true
+	}
+
+	return "", "", false
+}
+
+func matchHost(host, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
@@ -0,0 +1,112 @@
+package urlx
+
+import (
+	neturl "net/url"
+	"slices"
+	"testing"
+)
+
+func TestUnwrap(t *testing.T) {
+	const destination = "https://github.com/org/repo?tab=readme#top"
+	escaped := neturl.QueryEscape(destination)
+
+	tests := []struct {
+		name          string
+		config        UnwrapConfig
+		url           string
+		want          string
+		wantUnwrapped []string
+	}{
+		{
+			name: "not wrapped",
+			url:  destination,
+			want: destination,
+		},
+		{
+			name:          "outlook safe links",
+			url:           "https://eur01.safelinks.protection.outlook.com/?url=" + escaped + "&data=abc&reserved=0",
+			want:          destination,
+			wantUnwrapped: []string{"outlook"},
+		},
+		{
+			name:          "google",
+			url:           "https://www.google.com/url?sa=t&q=" + escaped,
+			want:          destination,
+			wantUnwrapped: []string{"google"},
+		},
+		{
+			name:          "facebook",
+			url:           "https://l.facebook.com/l.php?u=" + escaped + "&h=AT0",
+			want:          destination,
+			wantUnwrapped: []string{"facebook"},
+		},
+		{
+			name:          "recursive",
+			url:           "https://slack-redir.net/link?url=" + neturl.QueryEscape("https://www.google.com/url?q="+escaped),
+			want:          destination,
+			wantUnwrapped: []string{"slack", "google"},
+		},
+		{
+			name:          "depth limit",
+			config:        UnwrapConfig{MaxDepth: 1},
+			url:           "https://slack-redir.net/link?url=" + neturl.QueryEscape("https://www.google.com/url?q="+escaped),
+			want:          "https://www.google.com/url?q=" + escaped,
+			wantUnwrapped: []string{"slack"},
+		},
+		{
+			name: "wrong path",
+			url:  "https://www.google.com/search?q=" + escaped,
+			want: "https://www.google.com/search?q=" + escaped,
+		},
+		{
+			name: "relative destination",
+			url:  "https://www.google.com/url?q=%2Fpath",
+			want: "https://www.google.com/url?q=%2Fpath",
+		},
+		{
+			name:   "disabled builtin",
+			config: UnwrapConfig{Disable: []string{"google"}},
+			url:    "https://www.google.com/url?q=" + escaped,
+			want:   "https://www.google.com/url?q=" + escaped,
+		},
+		{
+			name:   "all builtins disabled",
+			config: UnwrapConfig{Disable: []string{"all"}},
+			url:    "https://slack-redir.net/link?url=" + escaped,
+			want:   "https://slack-redir.net/link?url=" + escaped,
+		},
+		{
+			name: "custom wrapper",
+			config: UnwrapConfig{
+				Disable:  []string{"all"},
+				Wrappers: []WrapperConfig{{Name: "tracker", Host: "*.example.com", Path: "/click", Param: "to"}},
+			},
+			url:           "https://mail.example.com/click?to=" + escaped,
+			want:          destination,
+			wantUnwrapped: []string{"tracker"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := NewUnwrapper(tt.config)
+			if err != nil {
+				t.Fatalf("NewUnwrapper() error = %v", err)
+			}
+
+			got, unwrapped := u.Unwrap(tt.url)
+			if got != tt.want {
+				t.Errorf("Unwrap() = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(unwrapped, tt.wantUnwrapped) {
+				t.Errorf("Unwrap() unwrapped = %v, want %v", unwrapped, tt.wantUnwrapped)
+			}
+		})
+	}
+}
+
+func TestNewUnwrapperInvalid(t *testing.T) {
+	if _, err := NewUnwrapper(UnwrapConfig{Wrappers: []WrapperConfig{{Host: "example.com"}}}); err == nil {
+		t.Error("NewUnwrapper() did not return error for wrapper without param")
+	}
+}
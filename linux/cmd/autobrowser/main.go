@@ -1,26 +1,62 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+
 	"github.com/pltanton/autobrowser/common/pkg/app"
 	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/matchers/domainlistmatcher"
 	"github.com/pltanton/autobrowser/common/pkg/matchers/urlmatcher"
 	"github.com/pltanton/autobrowser/common/pkg/utils"
 	"github.com/pltanton/autobrowser/linux/internal/deinfo"
 	"github.com/pltanton/autobrowser/linux/internal/envx"
 	"github.com/pltanton/autobrowser/linux/internal/matchers/appmatcher"
+	"github.com/pltanton/autobrowser/linux/internal/matchers/callermatcher"
+	"github.com/pltanton/autobrowser/linux/internal/notifications"
 )
 
 func main() {
 	options := envx.GetOptions()
 	utils.SetLogLevel(options.LogLevel)
 
+	// Pretended source app can't be forwarded, such URLs are opened in process
+	forward := options.Command == envx.OPEN && !options.NoDaemon && options.Socket != "" && options.AppClass == "" && options.AppTitle == ""
+	if forward {
+		if status, ok := app.Forward(options.Socket, app.DaemonRequest{URL: options.Url, CallerPID: os.Getppid()}); ok {
+			os.Exit(status)
+		}
+	}
+
 	registry := matchers.NewMatcherRegistry()
 
 	// Might be reused to fetch other stuff for other providers
-	deInfoProvider := deinfo.New(options.Mode)
+	var deInfoProvider *deinfo.DeInfoProvider
+	if options.AppClass != "" || options.AppTitle != "" {
+		deInfoProvider = deinfo.NewStatic(deinfo.App{Class: options.AppClass, Title: options.AppTitle})
+	} else {
+		deInfoProvider = deinfo.New(options.Mode)
+	}
 
-	registry.RegisterMatcher("url", urlmatcher.New(options.Url))
+	registry.RegisterMatcher("url", urlmatcher.New())
+	registry.RegisterMatcher("domain_list", domainlistmatcher.New(filepath.Dir(options.ConfigPath)))
 	registry.RegisterMatcher("app", appmatcher.New(deInfoProvider))
+	callers := callermatcher.NewChain(os.Getppid())
+	registry.RegisterMatcher("caller", callermatcher.New(callers))
 
-	app.SetupAndRun(options.ConfigPath, options.Url, registry)
+	switch options.Command {
+	case envx.EXPLAIN:
+		app.Explain(options.ConfigPath, options.Url, registry, options.JSON)
+	case envx.VALIDATE:
+		app.Validate(options.ConfigPath, registry)
+	case envx.CHOICES:
+		app.Choices(options.ConfigPath, options.Args)
+	case envx.DAEMON:
+		app.Serve(options.ConfigPath, options.Socket, registry, notifications.New(), func(req app.DaemonRequest) {
+			deInfoProvider.Reset()
+			callers.Reset(req.CallerPID)
+		})
+	default:
+		app.SetupAndRun(options.ConfigPath, options.Url, registry, notifications.New())
+	}
 }
@@ -4,18 +4,37 @@ import (
 	"log/slog"
 
 	"github.com/pltanton/autobrowser/linux/internal/envx"
+	"github.com/pltanton/autobrowser/linux/internal/procfs"
 )
 
 type App struct {
 	Class string
 	Title string
+	// Instance and Role are set for X11 windows only, they are the instance
+	// part of WM_CLASS and WM_WINDOW_ROLE
+	Instance string
+	Role     string
+	// PID of the window owner, 0 if unknown
+	PID int
+	// Workspace and window placement are reported by hyprland, sway, i3 and
+	// niri. WorkspaceID is the workspace number, 0 if unknown.
+	Workspace   string
+	WorkspaceID int
+	Output      string
+	Floating    bool
+	Fullscreen  bool
+	// Process is read from /proc when PID is known
+	procfs.Process
 }
 
 type DeInfoProvider struct {
 	provider deInfoProvider
+	// static provider keeps the app on Reset
+	static bool
 
 	activeAppSet bool
 	activeApp    App
+	activeAppErr error
 }
 
 type deInfoProvider interface {
@@ -38,8 +57,18 @@ func New(appMode envx.AppMode) *DeInfoProvider {
 		provider = newHyprlandProvider()
 	case envx.SWAY:
 		provider = newSwayProvider()
+	case envx.I3:
+		provider = newI3Provider()
 	case envx.GNOME:
 		provider = newGnomeProvider()
+	case envx.NIRI:
+		provider = newNiriProvider()
+	case envx.WLR:
+		provider = newWlrProvider()
+	case envx.KDE:
+		provider = newKdeProvider()
+	case envx.X11:
+		provider = newX11Provider()
 	case envx.UNKNOWN:
 		provider = noopProvider{}
 	}
@@ -49,16 +78,46 @@ func New(appMode envx.AppMode) *DeInfoProvider {
 	}
 }
 
-func (p *DeInfoProvider) GetActiveApp() App {
+// NewStatic returns provider which always reports the given app, it is used
+// to pretend a source app without asking the desktop environment
+func NewStatic(app App) *DeInfoProvider {
+	return &DeInfoProvider{
+		provider:     noopProvider{},
+		static:       true,
+		activeAppSet: true,
+		activeApp:    app,
+	}
+}
+
+// GetActiveApp returns the active app, it is requested from the desktop
+// environment once and the result is reused including the error
+func (p *DeInfoProvider) GetActiveApp() (App, error) {
 	if !p.activeAppSet {
-		var err error
-		p.activeApp, err = p.provider.fetchActiveApp()
+		p.activeApp, p.activeAppErr = p.provider.fetchActiveApp()
 		p.activeAppSet = true
 
-		if err != nil {
-			slog.Error("Failed to set active active app", "err", err)
+		if p.activeAppErr != nil {
+			slog.Error("Failed to get active app", "err", p.activeAppErr)
+		}
+
+		if p.activeApp.PID != 0 {
+			var err error
+			if p.activeApp.Process, err = procfs.Read(p.activeApp.PID); err != nil {
+				slog.Debug("Failed to read active app process", "err", err)
+			}
 		}
 	}
 
-	return p.activeApp
+	return p.activeApp, p.activeAppErr
+}
+
+// Reset forgets the active app, so it is requested again for the next URL
+func (p *DeInfoProvider) Reset() {
+	if p.static {
+		return
+	}
+
+	p.activeAppSet = false
+	p.activeApp = App{}
+	p.activeAppErr = nil
 }
@@ -0,0 +1,73 @@
+package deinfo
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGetActiveAppReadsProcess(t *testing.T) {
+	p := &DeInfoProvider{provider: staticProvider{App{Class: "test", PID: os.Getpid()}}}
+
+	app, err := p.GetActiveApp()
+	if err != nil {
+		t.Fatalf("GetActiveApp() error = %v", err)
+	}
+	if app.Exe == "" {
+		t.Errorf("GetActiveApp() did not read process details: %+v", app)
+	}
+}
+
+func TestGetActiveAppKeepsError(t *testing.T) {
+	p := &DeInfoProvider{provider: failingProvider{}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.GetActiveApp(); !errors.Is(err, errProviderFailed) {
+			t.Errorf("GetActiveApp() error = %v, want %v", err, errProviderFailed)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	provider := &countingProvider{}
+	p := &DeInfoProvider{provider: provider}
+
+	p.GetActiveApp()
+	p.GetActiveApp()
+	p.Reset()
+	p.GetActiveApp()
+	if provider.calls != 2 {
+		t.Errorf("active app fetched %d times, want 2", provider.calls)
+	}
+
+	static := NewStatic(App{Class: "test"})
+	static.Reset()
+	if app, _ := static.GetActiveApp(); app.Class != "test" {
+		t.Errorf("GetActiveApp() = %+v after Reset of static provider, want the static app", app)
+	}
+}
+
+type countingProvider struct {
+	calls int
+}
+
+func (c *countingProvider) fetchActiveApp() (App, error) {
+	c.calls++
+	return App{}, nil
+}
+
+type staticProvider struct {
+	app App
+}
+
+func (s staticProvider) fetchActiveApp() (App, error) {
+	return s.app, nil
+}
+
+var errProviderFailed = errors.New("provider failed")
+
+type failingProvider struct{}
+
+func (failingProvider) fetchActiveApp() (App, error) {
+	return App{}, errProviderFailed
+}
@@ -14,32 +14,36 @@ type gnomeProvider struct {
 // fetchActiveApp implements deInfoProvider.
 func (g *gnomeProvider) fetchActiveApp() (App, error) {
 	slog.Debug("Fetch active app from gnome")
-	conn, err := dbus.ConnectSessionBus()
+	// The shared connection is kept open and established again once broken
+	conn, err := dbus.SessionBus()
 	if err != nil {
 		return App{}, fmt.Errorf("failed to connect session bus: %w", err)
 	}
-	defer conn.Close()
 
 	var response string
 	obj := conn.Object("org.gnome.Shell", "/org/gnome/shell/extensions/FocusedWindow")
 	if err := obj.Call("org.gnome.shell.extensions.FocusedWindow.Get", 0).Store(&response); err != nil {
-		slog.Error("Failed to call dbus method. Did you install Focused Window D-Bus gnome extension?", "err", err)
-		return App{}, nil
+		return App{}, fmt.Errorf("failed to call focused window dbus method, is Focused Window D-Bus gnome extension installed: %w", err)
 	}
 
 	resultJson := struct {
-		Title string `json:"title"`
-		Class string `json:"wm_class"`
+		Title    string `json:"title"`
+		Class    string `json:"wm_class"`
+		Instance string `json:"wm_class_instance"`
+		Role     string `json:"role"`
+		PID      int    `json:"pid"`
 	}{}
 
 	if err := json.Unmarshal([]byte(response), &resultJson); err != nil {
-		slog.Error("Failed to unmarshal dbus response", "err", err, "response", response)
-		return App{}, nil
+		return App{}, fmt.Errorf("failed to unmarshal focused window response %q: %w", response, err)
 	}
 
 	return App{
-		Class: resultJson.Class,
-		Title: resultJson.Title,
+		Class:    resultJson.Class,
+		Title:    resultJson.Title,
+		Instance: resultJson.Instance,
+		Role:     resultJson.Role,
+		PID:      resultJson.PID,
 	}, nil
 }
 
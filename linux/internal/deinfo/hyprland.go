@@ -26,10 +26,33 @@ func (h *hyprlandProvider) fetchActiveApp() (App, error) {
 		return App{}, fmt.Errorf("failed to fetch active window from hyprland: %w", err)
 	}
 
-	return App{
-		Title: window.Title,
-		Class: window.Class,
-	}, nil
+	app := App{
+		Title:       window.Title,
+		Class:       window.Class,
+		PID:         window.Pid,
+		Workspace:   window.Workspace.Name,
+		WorkspaceID: window.Workspace.Id,
+		Floating:    window.Floating,
+	}
+
+	// Active window reply has only the monitor id and no fullscreen state, the
+	// workspace knows the monitor name and whether it has a fullscreen window,
+	// which is the focused one in practice
+	workspaces, err := h.c.Workspaces()
+	if err != nil {
+		slog.Debug("Failed to fetch workspaces from hyprland", "err", err)
+		return app, nil
+	}
+
+	for _, workspace := range workspaces {
+		if workspace.Id == window.Workspace.Id {
+			app.Output = workspace.Monitor
+			app.Fullscreen = workspace.HasFullScreen
+			break
+		}
+	}
+
+	return app, nil
 }
 
 var _ deInfoProvider = &hyprlandProvider{}
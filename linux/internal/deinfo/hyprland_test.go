@@ -0,0 +1,73 @@
+package deinfo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	ipc "github.com/labi-le/hyprland-ipc-client/v3"
+)
+
+// fakeHyprland implements the requests used by hyprlandProvider only
+type fakeHyprland struct {
+	ipc.IPC
+
+	window        ipc.Window
+	workspaces    []ipc.Workspace
+	workspacesErr error
+}
+
+func (f *fakeHyprland) ActiveWindow() (ipc.Window, error) {
+	return f.window, nil
+}
+
+func (f *fakeHyprland) Workspaces() ([]ipc.Workspace, error) {
+	return f.workspaces, f.workspacesErr
+}
+
+func TestHyprlandProvider(t *testing.T) {
+	window := ipc.Window{
+		Class:     "firefox",
+		Title:     "Mozilla Firefox",
+		Pid:       4242,
+		Workspace: ipc.WorkspaceType{Id: 2, Name: "web"},
+		Floating:  true,
+		Monitor:   1,
+	}
+	workspaces := []ipc.Workspace{
+		{WorkspaceType: ipc.WorkspaceType{Id: 1, Name: "1"}, Monitor: "eDP-1"},
+		{WorkspaceType: ipc.WorkspaceType{Id: 2, Name: "web"}, Monitor: "DP-1", HasFullScreen: true},
+	}
+
+	tests := []struct {
+		name string
+		c    *fakeHyprland
+		want App
+	}{
+		{
+			name: "active window",
+			c:    &fakeHyprland{window: window, workspaces: workspaces},
+			want: App{
+				Class: "firefox", Title: "Mozilla Firefox", PID: 4242,
+				Workspace: "web", WorkspaceID: 2, Output: "DP-1", Floating: true, Fullscreen: true,
+			},
+		},
+		{
+			name: "workspaces error",
+			c:    &fakeHyprland{window: window, workspacesErr: errors.New("broken pipe")},
+			want: App{Class: "firefox", Title: "Mozilla Firefox", PID: 4242, Workspace: "web", WorkspaceID: 2, Floating: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&hyprlandProvider{c: tt.c}).fetchActiveApp()
+			if err != nil {
+				t.Fatalf("fetchActiveApp() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fetchActiveApp() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
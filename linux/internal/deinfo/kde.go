@@ -0,0 +1,129 @@
+package deinfo
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	kwinService         = "org.kde.KWin"
+	kwinScriptingPath   = "/Scripting"
+	kwinScriptingIface  = "org.kde.kwin.Scripting"
+	kwinScriptIface     = "org.kde.kwin.Script"
+	kdeCallbackPath     = "/io/github/pltanton/autobrowser/KWin"
+	kdeCallbackIface    = "io.github.pltanton.autobrowser.KWin"
+	kdeCallbackTimeout  = time.Second
+	kdeActiveWindowFunc = "ActiveWindow"
+)
+
+// kwinScript reports the active window back to autobrowser, activeWindow is
+// the Plasma 6 name, activeClient is the Plasma 5 one. Values are passed as
+// strings to avoid JS number conversion issues.
+const kwinScript = `const w = workspace.activeWindow || workspace.activeClient;
+callDBus(%q, %q, %q, %q,
+	w ? String(w.resourceClass) : "",
+	w ? String(w.caption) : "",
+	w ? String(w.pid) : "0");
+`
+
+// kdeProvider asks KWin for the active window by loading a short lived KWin
+// script, which calls back to the method exported on our connection
+type kdeProvider struct {
+	// connect returns the shared session bus connection, it is kept open
+	connect func() (*dbus.Conn, error)
+}
+
+type kwinCallback chan App
+
+// ActiveWindow is called by the KWin script.
+func (c kwinCallback) ActiveWindow(class, caption, pid string) *dbus.Error {
+	app := App{Class: class, Title: caption}
+	app.PID, _ = strconv.Atoi(pid)
+
+	select {
+	case c <- app:
+	default:
+	}
+	return nil
+}
+
+// fetchActiveApp implements deInfoProvider.
+func (k *kdeProvider) fetchActiveApp() (App, error) {
+	slog.Debug("Fetch active app from KWin")
+
+	conn, err := k.connect()
+	if err != nil {
+		return App{}, fmt.Errorf("failed to connect session bus: %w", err)
+	}
+
+	callback := make(kwinCallback, 1)
+	if err := conn.ExportMethodTable(map[string]any{kdeActiveWindowFunc: callback.ActiveWindow}, kdeCallbackPath, kdeCallbackIface); err != nil {
+		return App{}, fmt.Errorf("failed to export callback: %w", err)
+	}
+	defer conn.Export(nil, kdeCallbackPath, kdeCallbackIface)
+
+	script, err := os.CreateTemp("", "autobrowser-kwin-*.js")
+	if err != nil {
+		return App{}, fmt.Errorf("failed to create KWin script: %w", err)
+	}
+	defer os.Remove(script.Name())
+
+	_, err = fmt.Fprintf(script, kwinScript, conn.Names()[0], kdeCallbackPath, kdeCallbackIface, kdeActiveWindowFunc)
+	if closeErr := script.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return App{}, fmt.Errorf("failed to write KWin script: %w", err)
+	}
+
+	scripting := conn.Object(kwinService, kwinScriptingPath)
+	pluginName := fmt.Sprintf("autobrowser-%d", os.Getpid())
+
+	var id int32
+	if err := scripting.Call(kwinScriptingIface+".loadScript", 0, script.Name(), pluginName).Store(&id); err != nil {
+		return App{}, fmt.Errorf("failed to load KWin script: %w", err)
+	}
+	defer scripting.Call(kwinScriptingIface+".unloadScript", 0, pluginName)
+
+	if err := runKWinScript(conn, id); err != nil {
+		return App{}, err
+	}
+
+	select {
+	case app := <-callback:
+		return app, nil
+	case <-time.After(kdeCallbackTimeout):
+		return App{}, fmt.Errorf("KWin script did not report the active window in %s", kdeCallbackTimeout)
+	}
+}
+
+// runKWinScript runs the loaded script, object path of the script differs
+// between Plasma 6 and Plasma 5
+func runKWinScript(conn *dbus.Conn, id int32) error {
+	paths := []dbus.ObjectPath{
+		dbus.ObjectPath(fmt.Sprintf("/Scripting/Script%d", id)),
+		dbus.ObjectPath(fmt.Sprintf("/%d", id)),
+	}
+
+	var err error
+	for _, path := range paths {
+		if err = conn.Object(kwinService, path).Call(kwinScriptIface+".run", 0).Err; err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to run KWin script: %w", err)
+}
+
+var _ deInfoProvider = &kdeProvider{}
+
+func newKdeProvider() deInfoProvider {
+	return &kdeProvider{
+		connect: dbus.SessionBus,
+	}
+}
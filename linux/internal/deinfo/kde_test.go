@@ -0,0 +1,180 @@
+package deinfo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// startSessionBus starts a private dbus-daemon and returns its address
+func startSessionBus(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	address := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address", "--address="+address)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	// The address is printed once the bus is ready
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read dbus-daemon address: %v", err)
+	}
+
+	return strings.TrimSpace(line)
+}
+
+// sharedBus returns connect func of a connection kept open during the test,
+// like dbus.SessionBus
+func sharedBus(t *testing.T, address string) func() (*dbus.Conn, error) {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("failed to connect to bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return func() (*dbus.Conn, error) { return conn, nil }
+}
+
+var callDBusRegex = regexp.MustCompile(`callDBus\("([^"]*)", "([^"]*)", "([^"]*)", "([^"]*)"`)
+
+// fakeKWin implements the part of the KWin scripting interface used by the
+// provider, running a script calls back with the configured window
+type fakeKWin struct {
+	conn       *dbus.Conn
+	scriptPath dbus.ObjectPath
+	app        App
+
+	// Methods are called from dbus worker goroutines
+	mu       sync.Mutex
+	script   string
+	unloaded []string
+}
+
+func (k *fakeKWin) loadScript(path, pluginName string) (int32, *dbus.Error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, dbus.MakeFailedError(err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.script = string(content)
+	return 7, nil
+}
+
+func (k *fakeKWin) unloadScript(pluginName string) (bool, *dbus.Error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.unloaded = append(k.unloaded, pluginName)
+	return true, nil
+}
+
+func (k *fakeKWin) run() *dbus.Error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	m := callDBusRegex.FindStringSubmatch(k.script)
+	if m == nil {
+		return dbus.MakeFailedError(fmt.Errorf("unexpected script %q", k.script))
+	}
+
+	// The reply is not awaited like in KWin, which calls asynchronously
+	go k.conn.Object(m[1], dbus.ObjectPath(m[2])).Call(m[3]+"."+m[4], 0, k.app.Class, k.app.Title, fmt.Sprint(k.app.PID))
+	return nil
+}
+
+func startFakeKWin(t *testing.T, address string, scriptPath dbus.ObjectPath, app App) *fakeKWin {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("failed to connect to bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	k := &fakeKWin{conn: conn, scriptPath: scriptPath, app: app}
+
+	err = conn.ExportMethodTable(map[string]any{"loadScript": k.loadScript, "unloadScript": k.unloadScript}, kwinScriptingPath, kwinScriptingIface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ExportMethodTable(map[string]any{"run": k.run}, scriptPath, kwinScriptIface); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply, err := conn.RequestName(kwinService, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to request %s name: %v", kwinService, err)
+	}
+
+	return k
+}
+
+func TestKdeProvider(t *testing.T) {
+	tests := []struct {
+		name       string
+		scriptPath dbus.ObjectPath
+		app        App
+	}{
+		{"plasma 6", "/Scripting/Script7", App{Class: "org.kde.konsole", Title: "~ : zsh — Konsole", PID: 1234}},
+		{"plasma 5", "/7", App{Class: "firefox", Title: "Mozilla \"Firefox\"", PID: 42}},
+		{"no active window", "/Scripting/Script7", App{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := startSessionBus(t)
+			kwin := startFakeKWin(t, address, tt.scriptPath, tt.app)
+
+			// The shared connection is used by both fetches
+			provider := &kdeProvider{connect: sharedBus(t, address)}
+			for i := 0; i < 2; i++ {
+				got, err := provider.fetchActiveApp()
+				if err != nil {
+					t.Fatalf("fetchActiveApp() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.app) {
+					t.Errorf("fetchActiveApp() = %+v, want %+v", got, tt.app)
+				}
+			}
+			kwin.mu.Lock()
+			defer kwin.mu.Unlock()
+			if len(kwin.unloaded) != 2 {
+				t.Errorf("script was unloaded %d times, want 2", len(kwin.unloaded))
+			}
+		})
+	}
+}
+
+func TestKdeProviderNoKWin(t *testing.T) {
+	address := startSessionBus(t)
+
+	provider := &kdeProvider{connect: sharedBus(t, address)}
+	if _, err := provider.fetchActiveApp(); err == nil {
+		t.Errorf("fetchActiveApp() did not return error without KWin")
+	}
+}
@@ -0,0 +1,139 @@
+package deinfo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const niriTimeout = time.Second
+
+type niriProvider struct {
+	socketPath string
+}
+
+type niriWindow struct {
+	Title       string `json:"title"`
+	AppID       string `json:"app_id"`
+	PID         int    `json:"pid"`
+	WorkspaceID *int   `json:"workspace_id"`
+	IsFloating  bool   `json:"is_floating"`
+}
+
+type niriWorkspace struct {
+	ID int `json:"id"`
+	// Idx is the workspace number on its output
+	Idx    int     `json:"idx"`
+	Name   *string `json:"name"`
+	Output *string `json:"output"`
+}
+
+// niriReply is a reply to a request, either Ok or Err is set
+type niriReply struct {
+	Ok *struct {
+		FocusedWindow *niriWindow     `json:"FocusedWindow"`
+		Workspaces    []niriWorkspace `json:"Workspaces"`
+	} `json:"Ok"`
+	Err *string `json:"Err"`
+}
+
+// fetchActiveApp implements deInfoProvider.
+func (n *niriProvider) fetchActiveApp() (App, error) {
+	slog.Debug("Fetch active app from niri")
+
+	reply, err := n.request("FocusedWindow")
+	if err != nil {
+		return App{}, err
+	}
+
+	window := reply.Ok.FocusedWindow
+	if window == nil {
+		slog.Debug("No focused window")
+		return App{}, nil
+	}
+
+	app := App{
+		Class:    window.AppID,
+		Title:    window.Title,
+		PID:      window.PID,
+		Floating: window.IsFloating,
+	}
+
+	if window.WorkspaceID == nil {
+		return app, nil
+	}
+
+	if reply, err = n.request("Workspaces"); err != nil {
+		slog.Debug("Failed to fetch workspaces from niri", "err", err)
+		return app, nil
+	}
+
+	for _, workspace := range reply.Ok.Workspaces {
+		if workspace.ID != *window.WorkspaceID {
+			continue
+		}
+
+		// Unnamed workspaces are referred by their number, like in niri msg
+		app.WorkspaceID = workspace.Idx
+		app.Workspace = strconv.Itoa(workspace.Idx)
+		if workspace.Name != nil {
+			app.Workspace = *workspace.Name
+		}
+		if workspace.Output != nil {
+			app.Output = *workspace.Output
+		}
+		break
+	}
+
+	return app, nil
+}
+
+// request sends the request over a new connection and returns successful reply
+func (n *niriProvider) request(request string) (niriReply, error) {
+	conn, err := net.DialTimeout("unix", n.socketPath, niriTimeout)
+	if err != nil {
+		return niriReply{}, fmt.Errorf("failed to connect to niri socket: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(niriTimeout)); err != nil {
+		return niriReply{}, err
+	}
+
+	// Requests and replies are single line JSON documents
+	if _, err := fmt.Fprintf(conn, "%q\n", request); err != nil {
+		return niriReply{}, fmt.Errorf("failed to send request to niri: %w", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return niriReply{}, fmt.Errorf("failed to read niri reply: %w", err)
+	}
+
+	var reply niriReply
+	if err := json.Unmarshal(line, &reply); err != nil {
+		return niriReply{}, fmt.Errorf("failed to unmarshal niri reply: %w", err)
+	}
+
+	switch {
+	case reply.Err != nil:
+		return niriReply{}, fmt.Errorf("niri returned error: %s", *reply.Err)
+	case reply.Ok == nil:
+		return niriReply{}, fmt.Errorf("unexpected niri reply: %s", line)
+	}
+
+	return reply, nil
+}
+
+var _ deInfoProvider = &niriProvider{}
+
+func newNiriProvider() deInfoProvider {
+	return &niriProvider{
+		socketPath: os.Getenv("NIRI_SOCKET"),
+	}
+}
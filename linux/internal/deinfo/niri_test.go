@@ -0,0 +1,108 @@
+package deinfo
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// startFakeNiri replies to request lines with the replies by request name
+func startFakeNiri(t *testing.T, replies map[string]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "niri.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				request, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				reply, ok := replies[strings.Trim(request, "\"\n")]
+				if !ok {
+					reply = `{"Err":"unknown request"}`
+				}
+				conn.Write([]byte(reply + "\n"))
+			}()
+		}
+	}()
+
+	return path
+}
+
+func TestNiriProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies map[string]string
+		want    App
+		wantErr bool
+	}{
+		{
+			name: "focused window",
+			replies: map[string]string{
+				"FocusedWindow": `{"Ok":{"FocusedWindow":{"id":12,"title":"Mozilla Firefox","app_id":"firefox","pid":4242,"workspace_id":5,"is_focused":true,"is_floating":true}}}`,
+				"Workspaces":    `{"Ok":{"Workspaces":[{"id":4,"idx":1,"name":null,"output":"DP-1"},{"id":5,"idx":2,"name":"work","output":"eDP-1"}]}}`,
+			},
+			want: App{Class: "firefox", Title: "Mozilla Firefox", PID: 4242, Workspace: "work", WorkspaceID: 2, Output: "eDP-1", Floating: true},
+		},
+		{
+			name: "unnamed workspace",
+			replies: map[string]string{
+				"FocusedWindow": `{"Ok":{"FocusedWindow":{"id":12,"title":"foot","app_id":"foot","pid":42,"workspace_id":4,"is_focused":true,"is_floating":false}}}`,
+				"Workspaces":    `{"Ok":{"Workspaces":[{"id":4,"idx":1,"name":null,"output":"DP-1"}]}}`,
+			},
+			want: App{Class: "foot", Title: "foot", PID: 42, Workspace: "1", WorkspaceID: 1, Output: "DP-1"},
+		},
+		{
+			name: "workspaces error",
+			replies: map[string]string{
+				"FocusedWindow": `{"Ok":{"FocusedWindow":{"id":12,"title":"foot","app_id":"foot","pid":42,"workspace_id":4,"is_focused":true}}}`,
+			},
+			want: App{Class: "foot", Title: "foot", PID: 42},
+		},
+		{
+			name:    "no focused window",
+			replies: map[string]string{"FocusedWindow": `{"Ok":{"FocusedWindow":null}}`},
+			want:    App{},
+		},
+		{
+			name:    "error",
+			replies: map[string]string{"FocusedWindow": `{"Err":"error parsing request"}`},
+			wantErr: true,
+		},
+		{
+			name:    "invalid reply",
+			replies: map[string]string{"FocusedWindow": `{"Ok"`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NIRI_SOCKET", startFakeNiri(t, tt.replies))
+
+			got, err := newNiriProvider().fetchActiveApp()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchActiveApp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fetchActiveApp() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,50 +4,174 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
 	"time"
 
 	sway "github.com/joshuarubin/go-sway"
 )
 
-type swayProvider struct{}
+// swayTimeout limits how long the tree is waited for
+const swayTimeout = time.Second
+
+// swayProvider talks i3 compatible IPC, so it is used for both sway and i3
+type swayProvider struct {
+	name string
+	// socketPath returns IPC socket path, empty path means $SWAYSOCK
+	socketPath func() (string, error)
+
+	// client is kept between fetches, canceling closes its connection
+	client sway.Client
+	cancel context.CancelFunc
+}
 
 // fetchActiveApp implements deInfoProvider.
 func (s *swayProvider) fetchActiveApp() (App, error) {
-	slog.Debug("Fetch active app from sway")
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
-	defer cancel()
+	slog.Debug("Fetch active app from " + s.name)
 
-	client, err := sway.New(ctx)
+	reused := s.client != nil
+	node, err := s.getTree()
+	if err != nil && reused {
+		// The compositor could be restarted since the last fetch
+		slog.Debug("Reconnecting to "+s.name, "err", err)
+		node, err = s.getTree()
+	}
 	if err != nil {
-		return App{}, fmt.Errorf("failed to create new sway client: %w", err)
+		return App{}, err
 	}
 
-	node, err := client.GetTree(context.Background())
-	if err != nil {
-		return App{}, fmt.Errorf("failed to get sway tree: %w", err)
+	path := focusedPath(node)
+	if path == nil {
+		slog.Debug("No focused node")
+		return App{}, nil
 	}
+	focusedNode := path[len(path)-1]
 
-	focusedNode := node.FocusedNode()
+	app := App{
+		Title:      focusedNode.Name,
+		Fullscreen: focusedNode.FullscreenMode != sway.FullscreenNone,
+	}
 
-	var class string
-	var title string = focusedNode.Name
+	// Sway marks the floating window itself, i3 wraps it into a floating con
+	for _, n := range path {
+		switch n.Type {
+		case sway.NodeOutput:
+			app.Output = n.Name
+		case sway.NodeWorkspace:
+			app.Workspace = n.Name
+			app.WorkspaceID = workspaceNumber(n.Name)
+		case sway.NodeFloatingCon:
+			app.Floating = true
+		}
+	}
 
 	if focusedNode.WindowProperties != nil {
-		// For xwayland clients
-		class = focusedNode.WindowProperties.Class
-		title = focusedNode.WindowProperties.Title
+		// For X11 and xwayland clients
+		app.Class = focusedNode.WindowProperties.Class
+		app.Instance = focusedNode.WindowProperties.Instance
+		app.Role = focusedNode.WindowProperties.Role
+		app.Title = focusedNode.WindowProperties.Title
 	} else if focusedNode.AppID != nil {
-		class = *focusedNode.AppID
+		app.Class = *focusedNode.AppID
+	}
+
+	if focusedNode.PID != nil {
+		app.PID = int(*focusedNode.PID)
+	}
+
+	return app, nil
+}
+
+// getTree gets the tree with the kept client, the client is dropped on error
+func (s *swayProvider) getTree() (*sway.Node, error) {
+	if s.client == nil {
+		socketPath, err := s.socketPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s socket path: %w", s.name, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		client, err := sway.New(ctx, sway.WithSocketPath(socketPath))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to create new %s client: %w", s.name, err)
+		}
+		s.client, s.cancel = client, cancel
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), swayTimeout)
+	defer cancel()
+
+	node, err := s.client.GetTree(ctx)
+	if err != nil {
+		s.cancel()
+		s.client, s.cancel = nil, nil
+		return nil, fmt.Errorf("failed to get %s tree: %w", s.name, err)
+	}
+	return node, nil
+}
+
+// focusedPath returns nodes from the root to the focused one, nil if nothing
+// is focused
+func focusedPath(node *sway.Node) []*sway.Node {
+	if node.Focused {
+		return []*sway.Node{node}
+	}
+
+	for _, nodes := range [][]*sway.Node{node.Nodes, node.FloatingNodes} {
+		for _, child := range nodes {
+			if path := focusedPath(child); path != nil {
+				return append([]*sway.Node{node}, path...)
+			}
+		}
 	}
 
-	return App{
-		Title: title,
-		Class: class,
-	}, nil
+	return nil
+}
+
+// workspaceNumber parses the leading number of the workspace name the same way
+// sway and i3 do, 0 if the name does not start with a number
+func workspaceNumber(name string) int {
+	end := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(name)
+	}
+
+	num, err := strconv.Atoi(name[:end])
+	if err != nil {
+		return 0
+	}
+	return num
+}
+
+// i3SocketPath returns $I3SOCK or asks i3 for the socket path
+func i3SocketPath() (string, error) {
+	if path := strings.TrimSpace(os.Getenv("I3SOCK")); path != "" {
+		return path, nil
+	}
+
+	out, err := exec.Command("i3", "--get-socketpath").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run i3 --get-socketpath: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
 }
 
 func newSwayProvider() deInfoProvider {
-	return &swayProvider{}
+	return &swayProvider{
+		name:       "sway",
+		socketPath: func() (string, error) { return "", nil },
+	}
+}
+
+func newI3Provider() deInfoProvider {
+	return &swayProvider{
+		name:       "i3",
+		socketPath: i3SocketPath,
+	}
 }
 
 var _ deInfoProvider = &swayProvider{}
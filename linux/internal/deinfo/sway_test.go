@@ -0,0 +1,170 @@
+package deinfo
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeIPC serves i3 IPC socket replying to every message with the tree
+type fakeIPC struct {
+	path string
+
+	// Clients are served concurrently
+	mu       sync.Mutex
+	conns    []net.Conn
+	accepted int
+}
+
+func startFakeIPC(t *testing.T, tree string) *fakeIPC {
+	t.Helper()
+
+	f := &fakeIPC{path: filepath.Join(t.TempDir(), "ipc.sock")}
+	l, err := net.Listen("unix", f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.accepted++
+			f.mu.Unlock()
+
+			go func() {
+				defer conn.Close()
+				// Header is "i3-ipc" magic, payload length and message type
+				header := make([]byte, 14)
+				for {
+					if _, err := io.ReadFull(conn, header); err != nil {
+						return
+					}
+					if _, err := io.CopyN(io.Discard, conn, int64(binary.LittleEndian.Uint32(header[6:10]))); err != nil {
+						return
+					}
+
+					binary.LittleEndian.PutUint32(header[6:10], uint32(len(tree)))
+					conn.Write(append(header, tree...))
+				}
+			}()
+		}
+	}()
+
+	return f
+}
+
+// disconnect closes connections of all clients, like a restarted compositor
+func (f *fakeIPC) disconnect() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeIPC) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accepted
+}
+
+func TestI3Provider(t *testing.T) {
+	tests := []struct {
+		name string
+		tree string
+		want App
+	}{
+		{
+			name: "x11 window",
+			tree: `{"id": 1, "type": "root", "nodes": [{"id": 2, "type": "output", "name": "DP-1", "nodes": [{"id": 3, "type": "workspace", "name": "2: web", "nodes": [
+				{"id": 4, "type": "con", "focused": true, "name": "Mozilla Firefox", "fullscreen_mode": 1,
+				 "window_properties": {"class": "firefox", "instance": "Navigator", "window_role": "browser", "title": "Mozilla Firefox"}}
+			]}]}]}`,
+			want: App{
+				Class: "firefox", Instance: "Navigator", Role: "browser", Title: "Mozilla Firefox",
+				Workspace: "2: web", WorkspaceID: 2, Output: "DP-1", Fullscreen: true,
+			},
+		},
+		{
+			name: "i3 floating window",
+			tree: `{"id": 1, "type": "root", "nodes": [{"id": 2, "type": "output", "name": "eDP-1", "nodes": [{"id": 3, "type": "workspace", "name": "mail",
+				"nodes": [{"id": 4, "type": "con", "name": "terminal"}],
+				"floating_nodes": [{"id": 5, "type": "floating_con", "nodes": [
+					{"id": 6, "type": "con", "focused": true, "name": "Thunderbird",
+					 "window_properties": {"class": "thunderbird", "instance": "Mail", "title": "Thunderbird"}}
+				]}]
+			}]}]}`,
+			want: App{Class: "thunderbird", Instance: "Mail", Title: "Thunderbird", Workspace: "mail", Output: "eDP-1", Floating: true},
+		},
+		{
+			name: "wayland window",
+			tree: `{"id": 1, "type": "root", "nodes": [{"id": 2, "type": "output", "name": "DP-1", "nodes": [{"id": 3, "type": "workspace", "name": "3", "floating_nodes": [
+				{"id": 4, "type": "floating_con", "focused": true, "name": "foot", "app_id": "foot", "pid": 42}
+			]}]}]}`,
+			want: App{Class: "foot", Title: "foot", PID: 42, Workspace: "3", WorkspaceID: 3, Output: "DP-1", Floating: true},
+		},
+		{
+			name: "nothing focused",
+			tree: `{"id": 1, "type": "root"}`,
+			want: App{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("I3SOCK", startFakeIPC(t, tt.tree).path)
+
+			got, err := newI3Provider().fetchActiveApp()
+			if err != nil {
+				t.Fatalf("fetchActiveApp() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fetchActiveApp() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSwayProviderKeepsConnection tests that the connection is reused between
+// fetches and established again once the compositor drops it
+func TestSwayProviderKeepsConnection(t *testing.T) {
+	ipc := startFakeIPC(t, `{"id": 1, "type": "root", "nodes": [{"id": 2, "type": "con", "focused": true, "name": "foot", "app_id": "foot"}]}`)
+	t.Setenv("SWAYSOCK", ipc.path)
+	want := App{Class: "foot", Title: "foot"}
+
+	provider := newSwayProvider()
+	fetch := func() {
+		t.Helper()
+		got, err := provider.fetchActiveApp()
+		if err != nil {
+			t.Fatalf("fetchActiveApp() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("fetchActiveApp() = %+v, want %+v", got, want)
+		}
+	}
+
+	fetch()
+	fetch()
+	if got := ipc.connections(); got != 1 {
+		t.Errorf("accepted %d connections, want 1", got)
+	}
+
+	ipc.disconnect()
+	fetch()
+	if got := ipc.connections(); got != 2 {
+		t.Errorf("accepted %d connections after disconnect, want 2", got)
+	}
+}
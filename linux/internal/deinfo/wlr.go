@@ -0,0 +1,257 @@
+package deinfo
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pltanton/autobrowser/linux/internal/wayland"
+)
+
+const (
+	// ext-foreign-toplevel-list has no state event, so the activated toplevel
+	// can't be found with it and only the wlr protocol is supported
+	wlrManagerInterface = "zwlr_foreign_toplevel_manager_v1"
+
+	wlrManagerMaxVersion = 3
+	wlrTimeout           = time.Second
+
+	// wl_display
+	displaySyncRequest        = 0
+	displayGetRegistryRequest = 1
+	displayErrorEvent         = 0
+	// wl_registry
+	registryBindRequest = 0
+	registryGlobalEvent = 0
+	// wl_callback
+	callbackDoneEvent = 0
+	// zwlr_foreign_toplevel_manager_v1
+	wlrManagerStopRequest   = 0
+	wlrManagerToplevelEvent = 0
+	// zwlr_foreign_toplevel_handle_v1
+	wlrToplevelTitleEvent     = 0
+	wlrToplevelAppIDEvent     = 1
+	wlrToplevelStateEvent     = 4
+	wlrToplevelDestroyRequest = 7
+
+	wlrToplevelStateActivated = 2
+)
+
+// wlrProvider finds the activated toplevel with wlr foreign toplevel
+// management protocol, it is supported by most of wlroots based compositors
+type wlrProvider struct {
+	dial func() (*wayland.Conn, error)
+	// client is kept between fetches and dropped on error
+	client *wlrClient
+}
+
+type wlrToplevel struct {
+	appID     string
+	title     string
+	activated bool
+}
+
+type wlrClient struct {
+	conn   *wayland.Conn
+	nextID uint32
+
+	registry  uint32
+	manager   uint32
+	toplevels map[uint32]*wlrToplevel
+
+	// globals are names of advertised globals with their versions
+	globals map[string]wlrGlobal
+}
+
+type wlrGlobal struct {
+	name    uint32
+	version uint32
+}
+
+// fetchActiveApp implements deInfoProvider.
+func (w *wlrProvider) fetchActiveApp() (App, error) {
+	slog.Debug("Fetch active app with wlr foreign toplevel management")
+
+	reused := w.client != nil
+	app, err := w.fetch()
+	if err != nil && reused {
+		// The compositor could be restarted since the last fetch
+		slog.Debug("Reconnecting to wayland compositor", "err", err)
+		app, err = w.fetch()
+	}
+	return app, err
+}
+
+// fetch finds the activated toplevel with the kept client, the client is
+// dropped on error
+func (w *wlrProvider) fetch() (App, error) {
+	if w.client == nil {
+		client, err := w.connect()
+		if err != nil {
+			return App{}, err
+		}
+		w.client = client
+	}
+
+	app, err := w.client.activeApp()
+	if err != nil {
+		w.client.conn.Close()
+		w.client = nil
+	}
+	return app, err
+}
+
+// connect dials the compositor and receives the advertised globals
+func (w *wlrProvider) connect() (*wlrClient, error) {
+	conn, err := w.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &wlrClient{
+		conn:    conn,
+		nextID:  wayland.DisplayID + 1,
+		globals: map[string]wlrGlobal{},
+	}
+
+	c.registry = c.newID()
+	err = conn.Send(wayland.DisplayID, displayGetRegistryRequest, c.registry)
+	if err != nil {
+		err = fmt.Errorf("failed to get registry: %w", err)
+	} else {
+		err = c.roundtrip()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// activeApp binds the manager, which sends all existing toplevels with their
+// state right after binding, so a single roundtrip is enough to receive them.
+// The manager and the toplevels are released afterwards, so the idle
+// connection doesn't receive their events.
+func (c *wlrClient) activeApp() (App, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(wlrTimeout)); err != nil {
+		return App{}, err
+	}
+
+	// Globals changed since the last fetch are received with the roundtrip
+	if err := c.roundtrip(); err != nil {
+		return App{}, err
+	}
+
+	global, ok := c.globals[wlrManagerInterface]
+	if !ok {
+		return App{}, fmt.Errorf("compositor doesn't support %s", wlrManagerInterface)
+	}
+
+	c.manager = c.newID()
+	c.toplevels = map[uint32]*wlrToplevel{}
+	version := min(global.version, wlrManagerMaxVersion)
+	if err := c.conn.Send(c.registry, registryBindRequest, global.name, wlrManagerInterface, version, c.manager); err != nil {
+		return App{}, fmt.Errorf("failed to bind %s: %w", wlrManagerInterface, err)
+	}
+	if err := c.roundtrip(); err != nil {
+		return App{}, err
+	}
+
+	c.conn.Send(c.manager, wlrManagerStopRequest)
+	// Toplevels announced before the compositor handled stop are received too
+	if err := c.roundtrip(); err != nil {
+		return App{}, err
+	}
+
+	var activated *wlrToplevel
+	for id, toplevel := range c.toplevels {
+		if toplevel.activated {
+			activated = toplevel
+		}
+		c.conn.Send(id, wlrToplevelDestroyRequest)
+	}
+	c.toplevels = nil
+
+	if activated == nil {
+		slog.Debug("No activated toplevel")
+		return App{}, nil
+	}
+	return App{Class: activated.appID, Title: activated.title}, nil
+}
+
+func (c *wlrClient) newID() uint32 {
+	id := c.nextID
+	c.nextID++
+	return id
+}
+
+// roundtrip handles events until the compositor processed all sent requests
+func (c *wlrClient) roundtrip() error {
+	callback := c.newID()
+	if err := c.conn.Send(wayland.DisplayID, displaySyncRequest, callback); err != nil {
+		return fmt.Errorf("failed to sync: %w", err)
+	}
+
+	for {
+		msg, err := c.conn.Receive()
+		if err != nil {
+			return fmt.Errorf("failed to receive wayland event: %w", err)
+		}
+
+		if msg.Object == callback && msg.Opcode == callbackDoneEvent {
+			return nil
+		}
+
+		if err := c.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *wlrClient) handle(msg wayland.Message) error {
+	r := msg.Reader()
+
+	switch {
+	case msg.Object == wayland.DisplayID && msg.Opcode == displayErrorEvent:
+		object, code, message := r.ReadUint(), r.ReadUint(), r.ReadString()
+		return fmt.Errorf("wayland error on object %d, code %d: %s", object, code, message)
+
+	case msg.Object == c.registry && msg.Opcode == registryGlobalEvent:
+		name, iface, version := r.ReadUint(), r.ReadString(), r.ReadUint()
+		c.globals[iface] = wlrGlobal{name: name, version: version}
+
+	case msg.Object == c.manager && c.manager != 0 && msg.Opcode == wlrManagerToplevelEvent:
+		c.toplevels[r.ReadUint()] = &wlrToplevel{}
+
+	case c.toplevels[msg.Object] != nil:
+		toplevel := c.toplevels[msg.Object]
+		switch msg.Opcode {
+		case wlrToplevelTitleEvent:
+			toplevel.title = r.ReadString()
+		case wlrToplevelAppIDEvent:
+			toplevel.appID = r.ReadString()
+		case wlrToplevelStateEvent:
+			toplevel.activated = false
+			states := wayland.Message{Args: r.ReadArray()}.Reader()
+			for state := states.ReadUint(); states.Err == nil; state = states.ReadUint() {
+				if state == wlrToplevelStateActivated {
+					toplevel.activated = true
+				}
+			}
+		}
+	}
+
+	if r.Err != nil {
+		return fmt.Errorf("failed to decode event %d of object %d: %w", msg.Opcode, msg.Object, r.Err)
+	}
+	return nil
+}
+
+var _ deInfoProvider = &wlrProvider{}
+
+func newWlrProvider() deInfoProvider {
+	return &wlrProvider{
+		dial: func() (*wayland.Conn, error) { return wayland.Dial(wlrTimeout) },
+	}
+}
@@ -0,0 +1,244 @@
+package deinfo
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pltanton/autobrowser/linux/internal/wayland"
+)
+
+type fakeToplevel struct {
+	appID  string
+	title  string
+	states []uint32
+}
+
+// fakeCompositor advertises globals and sends toplevels once the manager is
+// bound, like wlroots does
+type fakeCompositor struct {
+	globals   []string
+	toplevels []fakeToplevel
+	// bindError makes the compositor respond to bind with protocol error
+	bindError bool
+
+	// Clients are served concurrently
+	mu        sync.Mutex
+	conns     []*wayland.Conn
+	accepted  int
+	destroyed int
+}
+
+func (f *fakeCompositor) serve(conn *wayland.Conn) {
+	defer conn.Close()
+
+	f.mu.Lock()
+	f.conns = append(f.conns, conn)
+	f.accepted++
+	f.mu.Unlock()
+
+	var registry uint32
+	nextID := uint32(0xff000000)
+
+	for {
+		msg, err := conn.Receive()
+		if err != nil {
+			return
+		}
+		r := msg.Reader()
+
+		switch {
+		case msg.Object == wayland.DisplayID && msg.Opcode == displayGetRegistryRequest:
+			registry = r.ReadUint()
+			for i, iface := range f.globals {
+				conn.Send(registry, registryGlobalEvent, uint32(i+1), iface, uint32(3))
+			}
+
+		case msg.Object == wayland.DisplayID && msg.Opcode == displaySyncRequest:
+			conn.Send(r.ReadUint(), callbackDoneEvent, uint32(0))
+
+		case msg.Object == registry && msg.Opcode == registryBindRequest:
+			_, iface, _, manager := r.ReadUint(), r.ReadString(), r.ReadUint(), r.ReadUint()
+			if f.bindError {
+				conn.Send(wayland.DisplayID, displayErrorEvent, registry, uint32(0), "invalid global")
+				continue
+			}
+			if iface != wlrManagerInterface {
+				continue
+			}
+
+			for _, toplevel := range f.toplevels {
+				handle := nextID
+				nextID++
+
+				states := make([]byte, 0, 4*len(toplevel.states))
+				for _, state := range toplevel.states {
+					states = binary.NativeEndian.AppendUint32(states, state)
+				}
+
+				conn.Send(manager, wlrManagerToplevelEvent, handle)
+				conn.Send(handle, wlrToplevelTitleEvent, toplevel.title)
+				conn.Send(handle, wlrToplevelAppIDEvent, toplevel.appID)
+				conn.Send(handle, wlrToplevelStateEvent, states)
+				// done
+				conn.Send(handle, 5)
+			}
+
+		case msg.Object >= 0xff000000 && msg.Opcode == wlrToplevelDestroyRequest:
+			f.mu.Lock()
+			f.destroyed++
+			f.mu.Unlock()
+		}
+	}
+}
+
+// disconnect closes connections of all clients, like a restarted compositor
+func (f *fakeCompositor) disconnect() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+// stats returns the number of accepted connections and destroyed toplevels
+func (f *fakeCompositor) stats() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accepted, f.destroyed
+}
+
+// startFakeCompositor listens on wayland socket pointed by environment
+func startFakeCompositor(t *testing.T, f *fakeCompositor) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	t.Setenv("WAYLAND_DISPLAY", "wayland-test")
+
+	l, err := net.Listen("unix", filepath.Join(dir, "wayland-test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(wayland.NewConn(conn))
+		}
+	}()
+}
+
+func TestWlrProvider(t *testing.T) {
+	globals := []string{"wl_compositor", "wl_seat", wlrManagerInterface}
+
+	tests := []struct {
+		name       string
+		compositor *fakeCompositor
+		want       App
+		wantErr    string
+	}{
+		{
+			name: "activated toplevel",
+			compositor: &fakeCompositor{globals: globals, toplevels: []fakeToplevel{
+				{appID: "foot", title: "~", states: []uint32{0}},
+				{appID: "firefox", title: "Mozilla Firefox", states: []uint32{0, wlrToplevelStateActivated}},
+				{appID: "slack", title: "Slack"},
+			}},
+			want: App{Class: "firefox", Title: "Mozilla Firefox"},
+		},
+		{
+			name: "nothing activated",
+			compositor: &fakeCompositor{globals: globals, toplevels: []fakeToplevel{
+				{appID: "foot", title: "~", states: []uint32{1}},
+			}},
+			want: App{},
+		},
+		{
+			name:       "only ext foreign toplevel list",
+			compositor: &fakeCompositor{globals: []string{"wl_compositor", "ext_foreign_toplevel_list_v1"}},
+			wantErr:    "doesn't support",
+		},
+		{
+			name:       "not supported",
+			compositor: &fakeCompositor{globals: []string{"wl_compositor"}},
+			wantErr:    "doesn't support",
+		},
+		{
+			name:       "protocol error",
+			compositor: &fakeCompositor{globals: globals, bindError: true},
+			wantErr:    "invalid global",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startFakeCompositor(t, tt.compositor)
+
+			got, err := newWlrProvider().fetchActiveApp()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchActiveApp() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchActiveApp() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fetchActiveApp() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWlrProviderKeepsConnection tests that the connection is reused between
+// fetches and established again once the compositor drops it
+func TestWlrProviderKeepsConnection(t *testing.T) {
+	compositor := &fakeCompositor{
+		globals: []string{"wl_compositor", wlrManagerInterface},
+		toplevels: []fakeToplevel{
+			{appID: "foot", title: "~"},
+			{appID: "firefox", title: "Mozilla Firefox", states: []uint32{wlrToplevelStateActivated}},
+		},
+	}
+	startFakeCompositor(t, compositor)
+	want := App{Class: "firefox", Title: "Mozilla Firefox"}
+
+	provider := newWlrProvider()
+	for i := 0; i < 2; i++ {
+		got, err := provider.fetchActiveApp()
+		if err != nil {
+			t.Fatalf("fetchActiveApp() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("fetchActiveApp() = %+v, want %+v", got, want)
+		}
+	}
+
+	// Toplevels of the first fetch are destroyed before the second one syncs
+	if accepted, destroyed := compositor.stats(); accepted != 1 || destroyed < 2 {
+		t.Errorf("accepted %d connections, destroyed %d toplevels, want 1 and at least 2", accepted, destroyed)
+	}
+
+	compositor.disconnect()
+	got, err := provider.fetchActiveApp()
+	if err != nil {
+		t.Fatalf("fetchActiveApp() after disconnect error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchActiveApp() after disconnect = %+v, want %+v", got, want)
+	}
+	if accepted, _ := compositor.stats(); accepted != 2 {
+		t.Errorf("accepted %d connections, want 2", accepted)
+	}
+}
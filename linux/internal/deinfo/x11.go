@@ -0,0 +1,119 @@
+package deinfo
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11Provider reads the active window from EWMH properties, it works with
+// any window manager supporting _NET_ACTIVE_WINDOW
+type x11Provider struct {
+	// display is passed to xgb, empty value means $DISPLAY
+	display string
+}
+
+// fetchActiveApp implements deInfoProvider.
+func (x *x11Provider) fetchActiveApp() (App, error) {
+	slog.Debug("Fetch active app from X11")
+
+	conn, err := xgb.NewConnDisplay(x.display)
+	if err != nil {
+		return App{}, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+	defer conn.Close()
+
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+
+	active, err := getProperty(conn, root, "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return App{}, err
+	}
+	if len(active) < 4 {
+		return App{}, fmt.Errorf("window manager does not support _NET_ACTIVE_WINDOW")
+	}
+
+	window := xproto.Window(xgb.Get32(active))
+	if window == 0 {
+		slog.Debug("No active window")
+		return App{}, nil
+	}
+
+	wmClass, err := getProperty(conn, window, "WM_CLASS")
+	if err != nil {
+		return App{}, err
+	}
+
+	title, err := getProperty(conn, window, "_NET_WM_NAME")
+	if err != nil {
+		return App{}, err
+	}
+	if len(title) == 0 {
+		// Fallback for clients not supporting EWMH
+		if title, err = getProperty(conn, window, "WM_NAME"); err != nil {
+			return App{}, err
+		}
+	}
+
+	role, err := getProperty(conn, window, "WM_WINDOW_ROLE")
+	if err != nil {
+		return App{}, err
+	}
+
+	pid, err := getProperty(conn, window, "_NET_WM_PID")
+	if err != nil {
+		return App{}, err
+	}
+
+	instance, class := parseWMClass(wmClass)
+	app := App{
+		Class:    class,
+		Instance: instance,
+		Role:     string(role),
+		Title:    string(title),
+	}
+	if len(pid) >= 4 {
+		app.PID = int(xgb.Get32(pid))
+	}
+
+	return app, nil
+}
+
+// getProperty returns the raw value of the window property, empty value is
+// returned if the property is not set
+func getProperty(conn *xgb.Conn, window xproto.Window, name string) ([]byte, error) {
+	atom, err := xproto.InternAtom(conn, true, uint16(len(name)), name).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to intern %s atom: %w", name, err)
+	}
+	if atom.Atom == xproto.AtomNone {
+		return nil, nil
+	}
+
+	// The length is in 32-bit units, titles longer than 4KiB are truncated
+	reply, err := xproto.GetProperty(conn, false, window, atom.Atom, xproto.GetPropertyTypeAny, 0, 1024).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s property: %w", name, err)
+	}
+
+	return reply.Value, nil
+}
+
+// parseWMClass splits WM_CLASS, which consists of null terminated instance
+// and class names
+func parseWMClass(value []byte) (string, string) {
+	instance, class, ok := strings.Cut(strings.TrimRight(string(value), "\x00"), "\x00")
+	if !ok {
+		return instance, instance
+	}
+	return instance, class
+}
+
+var _ deInfoProvider = &x11Provider{}
+
+func newX11Provider() deInfoProvider {
+	return &x11Provider{}
+}
@@ -0,0 +1,157 @@
+package deinfo
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+func TestParseWMClass(t *testing.T) {
+	tests := []struct {
+		value    string
+		instance string
+		class    string
+	}{
+		{"navigator\x00Firefox\x00", "navigator", "Firefox"},
+		{"navigator\x00Firefox", "navigator", "Firefox"},
+		{"Single\x00", "Single", "Single"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		instance, class := parseWMClass([]byte(tt.value))
+		if instance != tt.instance || class != tt.class {
+			t.Errorf("parseWMClass(%q) = %q, %q, want %q, %q", tt.value, instance, class, tt.instance, tt.class)
+		}
+	}
+}
+
+// startXvfb starts Xvfb on a free display and returns its name
+func startXvfb(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb is not installed")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Xvfb writes the chosen display number to fd 3 once it is ready
+	cmd := exec.Command("Xvfb", "-displayfd", "3", "-nolisten", "tcp")
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start Xvfb: %v", err)
+	}
+	w.Close()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	display, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read Xvfb display: %v", err)
+	}
+
+	return ":" + strings.TrimSpace(display)
+}
+
+func setProperty(t *testing.T, conn *xgb.Conn, window xproto.Window, name, typeName string, format byte, data []byte) {
+	t.Helper()
+
+	atom := func(name string) xproto.Atom {
+		reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+		if err != nil {
+			t.Fatalf("failed to intern %s: %v", name, err)
+		}
+		return reply.Atom
+	}
+
+	err := xproto.ChangePropertyChecked(conn, xproto.PropModeReplace, window, atom(name), atom(typeName),
+		format, uint32(len(data)/int(format/8)), data).Check()
+	if err != nil {
+		t.Fatalf("failed to set %s: %v", name, err)
+	}
+}
+
+func uint32Data(v uint32) []byte {
+	data := make([]byte, 4)
+	xgb.Put32(data, v)
+	return data
+}
+
+func TestX11Provider(t *testing.T) {
+	display := startXvfb(t)
+
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		t.Fatalf("failed to connect to Xvfb: %v", err)
+	}
+	defer conn.Close()
+
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	provider := &x11Provider{display: display}
+
+	// Xvfb has no window manager, so there is no _NET_ACTIVE_WINDOW yet
+	if _, err := provider.fetchActiveApp(); err == nil {
+		t.Errorf("fetchActiveApp() did not return error without window manager support")
+	}
+
+	newWindow := func() xproto.Window {
+		window, err := xproto.NewWindowId(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = xproto.CreateWindowChecked(conn, screen.RootDepth, window, screen.Root, 0, 0, 10, 10, 0,
+			xproto.WindowClassInputOutput, screen.RootVisual, 0, nil).Check()
+		if err != nil {
+			t.Fatalf("failed to create window: %v", err)
+		}
+		return window
+	}
+
+	ewmh := newWindow()
+	setProperty(t, conn, ewmh, "WM_CLASS", "STRING", 8, []byte("navigator\x00Firefox\x00"))
+	setProperty(t, conn, ewmh, "_NET_WM_NAME", "UTF8_STRING", 8, []byte("Привет — Mozilla Firefox"))
+	setProperty(t, conn, ewmh, "WM_NAME", "STRING", 8, []byte("legacy"))
+	setProperty(t, conn, ewmh, "_NET_WM_PID", "CARDINAL", 32, uint32Data(4242))
+	setProperty(t, conn, ewmh, "WM_WINDOW_ROLE", "STRING", 8, []byte("browser"))
+
+	legacy := newWindow()
+	setProperty(t, conn, legacy, "WM_CLASS", "STRING", 8, []byte("xterm\x00XTerm\x00"))
+	setProperty(t, conn, legacy, "WM_NAME", "STRING", 8, []byte("xterm"))
+
+	tests := []struct {
+		window xproto.Window
+		want   App
+	}{
+		{ewmh, App{Class: "Firefox", Instance: "navigator", Role: "browser", Title: "Привет — Mozilla Firefox", PID: 4242}},
+		{legacy, App{Class: "XTerm", Instance: "xterm", Title: "xterm"}},
+		{0, App{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.window), func(t *testing.T) {
+			setProperty(t, conn, screen.Root, "_NET_ACTIVE_WINDOW", "WINDOW", 32, uint32Data(uint32(tt.window)))
+
+			got, err := provider.fetchActiveApp()
+			if err != nil {
+				t.Fatalf("fetchActiveApp() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fetchActiveApp() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,23 +2,48 @@ package envx
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 )
 
 type Options struct {
+	Command    Command
 	LogLevel   string
 	ConfigPath string
 	Url        string
 	Mode       AppMode
+
+	// Args are positional arguments left after flags
+	Args []string
+
+	// Socket is the daemon socket, NoDaemon opens the URL in process without
+	// forwarding it to the daemon
+	Socket   string
+	NoDaemon bool
+
+	// Explain options
+	JSON     bool
+	AppClass string
+	AppTitle string
 }
 
-var options Options
+var (
+	options     Options
+	optionsOnce sync.Once
+)
 
+// GetOptions parses command line on the first call, parsing is not done on
+// init to keep packages importing envx testable
 func GetOptions() Options {
+	optionsOnce.Do(parseOptions)
 	return options
 }
 
-func init() {
+func parseOptions() {
 	flags := struct {
 		ConfigPath string
 		Url        string
@@ -26,27 +51,122 @@ func init() {
 		HyprlandMode bool
 		GnomeMode    bool
 		SwayMode     bool
+		I3Mode       bool
+		NiriMode     bool
+		WlrMode      bool
+		KdeMode      bool
+		X11Mode      bool
 
 		LogLevel string
+
+		Socket   string
+		NoDaemon bool
+
+		JSON     bool
+		AppClass string
+		AppTitle string
 	}{}
 
 	dir, _ := os.UserHomeDir()
 	flag.StringVar(&flags.ConfigPath, "config", dir+"/.config/autobrowser/config.toml", "configuration file path")
 	flag.StringVar(&flags.Url, "url", "", "url to open")
 	flag.StringVar(&flags.LogLevel, "log", "INFO", "log level: DEBUG, INFO, WARN, ERROR")
+	flag.StringVar(&flags.Socket, "socket", defaultSocketPath(), "daemon socket path")
+	flag.BoolVar(&flags.NoDaemon, "no-daemon", false, "open: do not forward the URL to the daemon")
 
 	flag.BoolVar(&flags.HyprlandMode, "hyprland", false, "use hyprland IPC for app matcher")
 	flag.BoolVar(&flags.GnomeMode, "gnome", false, "use gnome DBUS protocol for app matcher")
 	flag.BoolVar(&flags.SwayMode, "sway", false, "use sway IPC for app matcher")
+	flag.BoolVar(&flags.I3Mode, "i3", false, "use i3 IPC for app matcher")
+	flag.BoolVar(&flags.NiriMode, "niri", false, "use niri IPC for app matcher, fullscreen state is not reported")
+	flag.BoolVar(&flags.WlrMode, "wlr", false, "use wlr foreign toplevel wayland protocol for app matcher, only class and title are reported")
+	flag.BoolVar(&flags.KdeMode, "kde", false, "use KWin scripting DBUS interface for app matcher")
+	flag.BoolVar(&flags.X11Mode, "x11", false, "use X11 EWMH properties for app matcher")
+
+	flag.BoolVar(&flags.JSON, "json", false, "explain: print decision trace as JSON")
+	flag.StringVar(&flags.AppClass, "app-class", "", "explain: pretend the source app has this class")
+	flag.StringVar(&flags.AppTitle, "app-title", "", "explain: pretend the source app has this title")
 
-	flag.Parse()
+	flag.Usage = usage
+
+	command, args := parseCommand(os.Args[1:])
+	flag.CommandLine.Parse(args)
 
 	options = Options{
+		Command:    command,
 		ConfigPath: flags.ConfigPath,
 		Url:        flags.Url,
-		Mode:       getAppMode(flags.HyprlandMode, flags.GnomeMode, flags.SwayMode),
+		Mode:       getAppMode(flags.HyprlandMode, flags.GnomeMode, flags.SwayMode, flags.I3Mode, flags.NiriMode, flags.WlrMode, flags.KdeMode, flags.X11Mode),
 		LogLevel:   flags.LogLevel,
+		Args:       flag.Args(),
+		Socket:     flags.Socket,
+		NoDaemon:   flags.NoDaemon,
+		JSON:       flags.JSON,
+		AppClass:   flags.AppClass,
+		AppTitle:   flags.AppTitle,
+	}
+}
+
+// defaultSocketPath returns $XDG_RUNTIME_DIR/autobrowser.sock, empty when
+// XDG_RUNTIME_DIR is not set. There is no fallback to the temporary directory,
+// where another user could listen on the predictable path first.
+func defaultSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "autobrowser.sock")
 	}
+	return ""
+}
+
+type Command int
+
+const (
+	// OPEN evaluates rules and opens the URL, used when no command given
+	OPEN Command = iota
+	// EXPLAIN evaluates rules and prints the decision without opening the URL
+	EXPLAIN
+	// VALIDATE checks the configuration file and reports found issues
+	VALIDATE
+	// CHOICES lists, adds and forgets remembered choices
+	CHOICES
+	// DAEMON keeps the config loaded and opens URLs forwarded by clients
+	DAEMON
+)
+
+var commands = map[string]Command{
+	"open":     OPEN,
+	"explain":  EXPLAIN,
+	"validate": VALIDATE,
+	"choices":  CHOICES,
+	"daemon":   DAEMON,
+}
+
+// parseCommand splits optional leading command from the flags
+func parseCommand(args []string) (Command, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return OPEN, args
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+
+	return command, args[1:]
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  open      open the URL with a command selected by rules (default)")
+	fmt.Fprintln(out, "  explain   print how the URL would be routed without opening it")
+	fmt.Fprintln(out, "  validate  check the configuration file for errors")
+	fmt.Fprintln(out, "  choices   manage remembered choices: list, add <host> <command>, forget <host>")
+	fmt.Fprintln(out, "  daemon    keep the config loaded and open URLs forwarded by open")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
 
 type AppMode int
@@ -56,9 +176,14 @@ const (
 	HYPRLAND
 	GNOME
 	SWAY
+	I3
+	NIRI
+	WLR
+	KDE
+	X11
 )
 
-func getAppMode(hyprlandFlag, gnomeFlag, swayFlag bool) AppMode {
+func getAppMode(hyprlandFlag, gnomeFlag, swayFlag, i3Flag, niriFlag, wlrFlag, kdeFlag, x11Flag bool) AppMode {
 	switch {
 	case hyprlandFlag:
 		return HYPRLAND
@@ -66,16 +191,39 @@ func getAppMode(hyprlandFlag, gnomeFlag, swayFlag bool) AppMode {
 		return GNOME
 	case swayFlag:
 		return SWAY
+	case i3Flag:
+		return I3
+	case niriFlag:
+		return NIRI
+	case wlrFlag:
+		return WLR
+	case kdeFlag:
+		return KDE
+	case x11Flag:
+		return X11
 	}
 
 	// Try to determine it then
 	switch {
 	case os.Getenv("SWAYSOCK") != "":
 		return SWAY
+	// Sway sets I3SOCK as well, so it is checked after SWAYSOCK
+	case os.Getenv("I3SOCK") != "" || os.Getenv("XDG_CURRENT_DESKTOP") == "i3":
+		return I3
 	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
 		return HYPRLAND
 	case os.Getenv("DESKTOP_SESSION") == "gnome":
 		return GNOME
+	case slices.Contains(strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":"), "KDE"):
+		return KDE
+	case os.Getenv("NIRI_SOCKET") != "":
+		return NIRI
+	// Other wayland compositors are asked with wlr foreign toplevel protocol,
+	// their DISPLAY points to XWayland, which doesn't know about native windows
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		return WLR
+	case os.Getenv("DISPLAY") != "":
+		return X11
 	}
 
 	return UNKNOWN
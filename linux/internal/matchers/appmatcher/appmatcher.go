@@ -2,57 +2,247 @@ package appmatcher
 
 import (
 	"fmt"
-	"log/slog"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/pltanton/autobrowser/common/pkg/matchers"
 	"github.com/pltanton/autobrowser/linux/internal/deinfo"
 )
 
+type appMatcherFactory struct {
+	provider *deinfo.DeInfoProvider
+}
+
 type appMatcher struct {
 	provider *deinfo.DeInfoProvider
+
+	class    string
+	instance string
+	role     string
+	title    *regexp.Regexp
+
+	exe       string
+	cmdline   *regexp.Regexp
+	unit      string
+	flatpakID string
+	snapName  string
+
+	workspace   *regexp.Regexp
+	workspaceID *int
+	output      string
+	floating    *bool
+	fullscreen  *bool
 }
 
 type appMatcherConfig struct {
 	Class string `toml:"class,omitempty"`
 	Title string `toml:"title,omitempty"`
+	// Instance and Role are available for X11 windows only
+	Instance string `toml:"instance,omitempty"`
+	Role     string `toml:"window_role,omitempty"`
+
+	// Process properties are available when the window PID is known. Exe
+	// without slashes is matched against the executable base name.
+	Exe     string `toml:"exe,omitempty"`
+	Cmdline string `toml:"cmdline,omitempty"`
+	Unit    string `toml:"unit,omitempty"`
+
+	FlatpakID string `toml:"flatpak_id,omitempty"`
+	SnapName  string `toml:"snap_name,omitempty"`
+
+	// Workspace and window placement are available on hyprland, sway, i3 and
+	// niri. Workspace is a regex matched against the workspace name.
+	Workspace   string `toml:"workspace,omitempty"`
+	WorkspaceID *int   `toml:"workspace_id,omitempty"`
+	Output      string `toml:"output,omitempty"`
+	Floating    *bool  `toml:"floating,omitempty"`
+	Fullscreen  *bool  `toml:"fullscreen,omitempty"`
 }
 
-// Match implements matchers.Matcher.
-func (m *appMatcher) Match(configProvider matchers.MatcherConfigProvider) (bool, error) {
+// Compile implements matchers.Factory.
+func (f *appMatcherFactory) Compile(configProvider matchers.MatcherConfigProvider) (matchers.Matcher, error) {
 	var c appMatcherConfig
 	if err := configProvider(&c); err != nil {
-		return false, fmt.Errorf("failed to load app matcher config: %w", err)
+		return nil, fmt.Errorf("failed to load app matcher config: %w", err)
 	}
 
-	if c.Class != "" && !m.matchByClass(c.Class) {
-		return false, nil
+	m := &appMatcher{
+		provider:  f.provider,
+		class:     c.Class,
+		instance:  c.Instance,
+		role:      c.Role,
+		exe:       c.Exe,
+		unit:      c.Unit,
+		flatpakID: c.FlatpakID,
+		snapName:  c.SnapName,
+
+		workspaceID: c.WorkspaceID,
+		output:      c.Output,
+		floating:    c.Floating,
+		fullscreen:  c.Fullscreen,
 	}
 
-	if c.Title != "" && !m.matchByTitle(c.Title) {
-		return false, nil
+	if c.Title != "" {
+		var err error
+		if m.title, err = regexp.Compile(c.Title); err != nil {
+			return nil, fmt.Errorf("invalid title regex: %w", err)
+		}
 	}
 
-	return true, nil
+	if c.Cmdline != "" {
+		var err error
+		if m.cmdline, err = regexp.Compile(c.Cmdline); err != nil {
+			return nil, fmt.Errorf("invalid cmdline regex: %w", err)
+		}
+	}
+
+	if c.Workspace != "" {
+		var err error
+		if m.workspace, err = regexp.Compile(c.Workspace); err != nil {
+			return nil, fmt.Errorf("invalid workspace regex: %w", err)
+		}
+	}
+
+	return m, nil
 }
 
-func (m *appMatcher) matchByTitle(regex string) bool {
-	r, err := regexp.Compile(regex)
+// Field implements matchers.FieldProvider.
+func (f *appMatcherFactory) Field(name string) (string, bool) {
+	// Provider error is logged already, fields of unknown app are empty
+	app, _ := f.provider.GetActiveApp()
+
+	switch name {
+	case "class":
+		return app.Class, true
+	case "title":
+		return app.Title, true
+	case "instance":
+		return app.Instance, true
+	case "window_role":
+		return app.Role, true
+	case "pid":
+		if app.PID != 0 {
+			return strconv.Itoa(app.PID), true
+		}
+		return "", true
+	case "exe":
+		return app.Exe, true
+	case "cmdline":
+		return strings.Join(app.Cmdline, " "), true
+	case "cwd":
+		return app.Cwd, true
+	case "unit":
+		return app.Unit, true
+	case "flatpak_id":
+		return app.FlatpakID, true
+	case "snap_name":
+		return app.SnapName, true
+	case "workspace":
+		return app.Workspace, true
+	case "workspace_id":
+		if app.WorkspaceID != 0 {
+			return strconv.Itoa(app.WorkspaceID), true
+		}
+		return "", true
+	case "output":
+		return app.Output, true
+	case "floating":
+		return strconv.FormatBool(app.Floating), true
+	case "fullscreen":
+		return strconv.FormatBool(app.Fullscreen), true
+	}
+	return "", false
+}
+
+// FieldNames implements matchers.FieldProvider.
+func (f *appMatcherFactory) FieldNames() []string {
+	return []string{
+		"class", "title", "instance", "window_role", "pid", "exe", "cmdline", "cwd", "unit",
+		"flatpak_id", "snap_name", "workspace", "workspace_id", "output", "floating", "fullscreen",
+	}
+}
+
+// Match implements matchers.Matcher.
+func (m *appMatcher) Match(*matchers.Request) (bool, error) {
+	app, err := m.provider.GetActiveApp()
 	if err != nil {
-		slog.Error(fmt.Sprintf("Failed to compile regex '%s'", regex), "err", err)
+		return false, &matchers.ProviderError{Provider: "active window", Err: err}
+	}
+
+	if m.class != "" && app.Class != m.class {
+		return false, nil
+	}
+
+	if m.title != nil && !m.title.MatchString(app.Title) {
+		return false, nil
+	}
+
+	if m.instance != "" && app.Instance != m.instance {
+		return false, nil
 	}
 
-	return r.Match([]byte(m.provider.GetActiveApp().Title))
+	if m.role != "" && app.Role != m.role {
+		return false, nil
+	}
+
+	if m.exe != "" && !m.matchByExe(app.Exe) {
+		return false, nil
+	}
+
+	if m.cmdline != nil && !m.cmdline.MatchString(strings.Join(app.Cmdline, " ")) {
+		return false, nil
+	}
+
+	if m.unit != "" && app.Unit != m.unit {
+		return false, nil
+	}
+
+	if m.flatpakID != "" && app.FlatpakID != m.flatpakID {
+		return false, nil
+	}
+
+	if m.snapName != "" && app.SnapName != m.snapName {
+		return false, nil
+	}
+
+	if m.workspace != nil && !m.workspace.MatchString(app.Workspace) {
+		return false, nil
+	}
+
+	if m.workspaceID != nil && app.WorkspaceID != *m.workspaceID {
+		return false, nil
+	}
+
+	if m.output != "" && app.Output != m.output {
+		return false, nil
+	}
+
+	if m.floating != nil && app.Floating != *m.floating {
+		return false, nil
+	}
+
+	if m.fullscreen != nil && app.Fullscreen != *m.fullscreen {
+		return false, nil
+	}
+
+	return true, nil
 }
 
-func (h *appMatcher) matchByClass(class string) bool {
-	return h.provider.GetActiveApp().Class == class
+func (m *appMatcher) matchByExe(exe string) bool {
+	if !strings.Contains(m.exe, "/") {
+		exe = filepath.Base(exe)
+	}
+	return exe == m.exe
 }
 
+var _ matchers.Factory = &appMatcherFactory{}
+var _ matchers.FieldProvider = &appMatcherFactory{}
 var _ matchers.Matcher = &appMatcher{}
 
-func New(provider *deinfo.DeInfoProvider) matchers.Matcher {
-	return &appMatcher{
+func New(provider *deinfo.DeInfoProvider) matchers.Factory {
+	return &appMatcherFactory{
 		provider: provider,
 	}
 }
@@ -0,0 +1,133 @@
+package appmatcher
+
+import (
+	"testing"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/matchers/matcherstest"
+	"github.com/pltanton/autobrowser/linux/internal/deinfo"
+	"github.com/pltanton/autobrowser/linux/internal/procfs"
+)
+
+var app = deinfo.App{
+	Class:    "Slack",
+	Title:    "general - Slack",
+	Instance: "slack",
+	PID:      100,
+
+	Workspace:   "3: work",
+	WorkspaceID: 3,
+	Output:      "DP-1",
+	Floating:    true,
+	Process: procfs.Process{
+		Exe:       "/usr/lib/slack/slack",
+		Cmdline:   []string{"/usr/lib/slack/slack", "--enable-features=UseOzonePlatform"},
+		Cwd:       "/home/user",
+		Unit:      "app-flatpak-com.slack.Slack-1234.scope",
+		FlatpakID: "com.slack.Slack",
+	},
+}
+
+func compile(t *testing.T, config string) (matchers.Matcher, error) {
+	t.Helper()
+	return matcherstest.Compile(t, New(deinfo.NewStatic(app)), config)
+}
+
+func TestAppMatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   bool
+	}{
+		{"empty config", ``, true},
+		{"class", `class = "Slack"`, true},
+		{"class mismatch", `class = "slack"`, false},
+		{"title", `title = "^general"`, true},
+		{"instance", `instance = "slack"`, true},
+		{"window role mismatch", `window_role = "browser"`, false},
+		{"exe path", `exe = "/usr/lib/slack/slack"`, true},
+		{"exe base name", `exe = "slack"`, true},
+		{"exe mismatch", `exe = "/usr/bin/slack"`, false},
+		{"cmdline", `cmdline = "--enable-features=\\S*Ozone"`, true},
+		{"cmdline mismatch", `cmdline = "--incognito"`, false},
+		{"unit", `unit = "app-flatpak-com.slack.Slack-1234.scope"`, true},
+		{"unit mismatch", `unit = "app-slack.scope"`, false},
+		{"flatpak id", `flatpak_id = "com.slack.Slack"`, true},
+		{"flatpak id mismatch", `flatpak_id = "com.slack.Slack.Beta"`, false},
+		{"snap name mismatch", `snap_name = "slack"`, false},
+		{"workspace", `workspace = "^[1-4]:"`, true},
+		{"workspace mismatch", `workspace = "^[5-9]:"`, false},
+		{"workspace id", `workspace_id = 3`, true},
+		{"workspace id mismatch", `workspace_id = 4`, false},
+		{"output", `output = "DP-1"`, true},
+		{"output mismatch", `output = "eDP-1"`, false},
+		{"floating", `floating = true`, true},
+		{"floating mismatch", `floating = false`, false},
+		{"not fullscreen", `fullscreen = false`, true},
+		{"fullscreen mismatch", `fullscreen = true`, false},
+		{"all fields", `class = "Slack", exe = "slack", cmdline = "Ozone", unit = "app-flatpak-com.slack.Slack-1234.scope"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := compile(t, tt.config)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			got, err := m.Match(matchers.NewRequest("https://example.com"))
+			if err != nil {
+				t.Fatalf("Match() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppMatcherInvalidConfig(t *testing.T) {
+	for _, config := range []string{`title = "("`, `cmdline = "("`, `exe = 1`, `workspace = "("`, `floating = "yes"`} {
+		if _, err := compile(t, config); err == nil {
+			t.Errorf("Compile(%s) did not return error", config)
+		}
+	}
+}
+
+func TestAppMatcherField(t *testing.T) {
+	f := New(deinfo.NewStatic(app)).(matchers.FieldProvider)
+
+	tests := map[string]string{
+		"class":      "Slack",
+		"instance":   "slack",
+		"pid":        "100",
+		"exe":        "/usr/lib/slack/slack",
+		"cmdline":    "/usr/lib/slack/slack --enable-features=UseOzonePlatform",
+		"cwd":        "/home/user",
+		"unit":       "app-flatpak-com.slack.Slack-1234.scope",
+		"flatpak_id": "com.slack.Slack",
+		"snap_name":  "",
+
+		"workspace":    "3: work",
+		"workspace_id": "3",
+		"output":       "DP-1",
+		"floating":     "true",
+		"fullscreen":   "false",
+	}
+
+	for name, want := range tests {
+		if got, ok := f.Field(name); !ok || got != want {
+			t.Errorf("Field(%s) = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+
+	if _, ok := f.Field("unknown"); ok {
+		t.Errorf("Field(unknown) is reported as known")
+	}
+
+	for _, name := range f.FieldNames() {
+		if _, ok := f.Field(name); !ok {
+			t.Errorf("Field(%s) listed by FieldNames() is unknown", name)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package callermatcher
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/linux/internal/procfs"
+)
+
+// maxChainLength protects from walking forever on unexpected /proc content
+const maxChainLength = 64
+
+// caller is a process in the parent chain
+type caller struct {
+	pid  int
+	comm string
+	procfs.Process
+}
+
+// Chain lazily reads the chain of parent processes starting from pid
+type Chain struct {
+	pid int
+
+	once    sync.Once
+	callers []caller
+}
+
+type callerMatcherFactory struct {
+	chain *Chain
+}
+
+type callerMatcher struct {
+	chain *Chain
+
+	comm    string
+	exe     string
+	cmdline *regexp.Regexp
+	depth   int
+}
+
+type callerMatcherConfig struct {
+	Comm string `toml:"comm,omitempty"`
+	// Exe without slashes is matched against the executable base name
+	Exe     string `toml:"exe,omitempty"`
+	Cmdline string `toml:"cmdline,omitempty"`
+	// Depth limits number of checked ancestors, 1 is the direct parent only,
+	// 0 checks the whole chain
+	Depth int `toml:"depth,omitempty"`
+}
+
+// Compile implements matchers.Factory.
+func (f *callerMatcherFactory) Compile(configProvider matchers.MatcherConfigProvider) (matchers.Matcher, error) {
+	var c callerMatcherConfig
+	if err := configProvider(&c); err != nil {
+		return nil, fmt.Errorf("failed to load caller matcher config: %w", err)
+	}
+
+	if c.Depth < 0 {
+		return nil, fmt.Errorf("depth must not be negative")
+	}
+
+	m := &callerMatcher{
+		chain: f.chain,
+		comm:  c.Comm,
+		exe:   c.Exe,
+		depth: c.Depth,
+	}
+
+	if c.Cmdline != "" {
+		var err error
+		if m.cmdline, err = regexp.Compile(c.Cmdline); err != nil {
+			return nil, fmt.Errorf("invalid cmdline regex: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Match implements matchers.Matcher.
+func (m *callerMatcher) Match(*matchers.Request) (bool, error) {
+	for i, c := range m.chain.get() {
+		if m.depth > 0 && i >= m.depth {
+			break
+		}
+
+		if m.matchCaller(c) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *callerMatcher) matchCaller(c caller) bool {
+	if m.comm != "" && c.comm != m.comm {
+		return false
+	}
+
+	if m.exe != "" {
+		exe := c.Exe
+		if !strings.Contains(m.exe, "/") {
+			exe = filepath.Base(exe)
+		}
+		if exe != m.exe {
+			return false
+		}
+	}
+
+	if m.cmdline != nil && !m.cmdline.MatchString(strings.Join(c.Cmdline, " ")) {
+		return false
+	}
+
+	return true
+}
+
+// NewChain returns the chain of parent processes starting from pid, usually
+// os.Getppid()
+func NewChain(pid int) *Chain {
+	return &Chain{pid: pid}
+}
+
+// Reset starts the chain from another process, the daemon resets it to the
+// caller of the client for every URL
+func (c *Chain) Reset(pid int) {
+	*c = Chain{pid: pid}
+}
+
+func (c *Chain) get() []caller {
+	c.once.Do(func() {
+		// PID 1 is init and PID 0 is the kernel, neither is an interesting caller
+		for pid := c.pid; pid > 1 && len(c.callers) < maxChainLength; {
+			comm, ppid, err := procfs.Stat(pid)
+			if err != nil {
+				slog.Debug("Failed to read caller process", "err", err)
+				break
+			}
+
+			process, err := procfs.Read(pid)
+			if err != nil {
+				slog.Debug("Failed to read caller process", "err", err)
+			}
+
+			c.callers = append(c.callers, caller{pid: pid, comm: comm, Process: process})
+			pid = ppid
+		}
+
+		slog.Debug("Caller chain is read", "length", len(c.callers))
+	})
+
+	return c.callers
+}
+
+var _ matchers.Factory = &callerMatcherFactory{}
+var _ matchers.Matcher = &callerMatcher{}
+
+// New returns factory of matchers checking the parent process chain
+func New(chain *Chain) matchers.Factory {
+	return &callerMatcherFactory{
+		chain: chain,
+	}
+}
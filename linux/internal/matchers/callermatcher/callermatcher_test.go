@@ -0,0 +1,108 @@
+package callermatcher
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/matchers/matcherstest"
+)
+
+// startSleep starts sleep and waits until /proc shows its command line
+func startSleep(t *testing.T) *exec.Cmd {
+	t.Helper()
+
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start sleep: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	// Start returns once exec closes the descriptors, cmdline is set up later
+	// and reads empty until then
+	cmdline := fmt.Sprintf("/proc/%d/cmdline", cmd.Process.Pid)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if content, err := os.ReadFile(cmdline); err == nil && string(content) == "sleep\x0010\x00" {
+			return cmd
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sleep is not executed")
+		}
+	}
+}
+
+func TestCallerMatcher(t *testing.T) {
+	// The chain is started from a child, so the test binary is its parent
+	cmd := startSleep(t)
+
+	testExe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		want   bool
+	}{
+		{"empty config", ``, true},
+		{"comm", `comm = "sleep"`, true},
+		{"comm mismatch", `comm = "thunderbird"`, false},
+		{"exe base name", `exe = "sleep"`, true},
+		{"cmdline", `cmdline = "^sleep 10$"`, true},
+		{"properties of different callers", `comm = "sleep", exe = "` + testExe + `"`, false},
+		{"parent exe", `exe = "` + testExe + `"`, true},
+		{"parent exe out of depth", `exe = "` + testExe + `", depth = 1`, false},
+		{"parent exe within depth", `exe = "` + testExe + `", depth = 2`, true},
+	}
+
+	factory := New(NewChain(cmd.Process.Pid))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := matcherstest.Compile(t, factory, tt.config)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+
+			got, err := m.Match(matchers.NewRequest("https://example.com"))
+			if err != nil {
+				t.Fatalf("Match() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallerMatcherInvalidConfig(t *testing.T) {
+	for _, config := range []string{`cmdline = "("`, `depth = -1`, `comm = 1`} {
+		if _, err := matcherstest.Compile(t, New(NewChain(os.Getppid())), config); err == nil {
+			t.Errorf("Compile(%s) did not return error", config)
+		}
+	}
+}
+
+func TestChainReset(t *testing.T) {
+	chain := NewChain(os.Getpid())
+	m, err := matcherstest.Compile(t, New(chain), `comm = "sleep"`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	if got, _ := m.Match(matchers.NewRequest("https://example.com")); got {
+		t.Fatal("Match() = true before the chain is reset to sleep")
+	}
+
+	cmd := startSleep(t)
+	chain.Reset(cmd.Process.Pid)
+	if got, _ := m.Match(matchers.NewRequest("https://example.com")); !got {
+		t.Error("Match() = false after the chain is reset to sleep")
+	}
+}
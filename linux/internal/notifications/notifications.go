@@ -0,0 +1,114 @@
+// Package notifications shows desktop notifications with the
+// org.freedesktop.Notifications D-Bus interface
+package notifications
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/pltanton/autobrowser/common/pkg/notify"
+)
+
+const (
+	notificationsService = "org.freedesktop.Notifications"
+	notificationsPath    = "/org/freedesktop/Notifications"
+	notificationsIface   = "org.freedesktop.Notifications"
+	appName              = "autobrowser"
+	appIcon              = "web-browser"
+)
+
+// Notifier sends notifications to the notification server on the session bus
+type Notifier struct {
+	// connect returns the shared session bus connection, it is kept open
+	connect func() (*dbus.Conn, error)
+}
+
+func New() *Notifier {
+	return &Notifier{
+		connect: dbus.SessionBus,
+	}
+}
+
+// Notify implements notify.Notifier.
+func (n *Notifier) Notify(notification notify.Notification) (string, error) {
+	conn, err := n.connect()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect session bus: %w", err)
+	}
+
+	obj := conn.Object(notificationsService, notificationsPath)
+
+	var capabilities []string
+	if err := obj.Call(notificationsIface+".GetCapabilities", 0).Store(&capabilities); err != nil {
+		return "", fmt.Errorf("failed to get capabilities of notification server: %w", err)
+	}
+
+	// URLs are full of ampersands, which break markup
+	body := notification.Body
+	if slices.Contains(capabilities, "body-markup") {
+		body = html.EscapeString(body)
+	}
+
+	var actions []string
+	if slices.Contains(capabilities, "actions") {
+		for _, action := range notification.Actions {
+			actions = append(actions, action.Key, action.Label)
+		}
+	}
+
+	// Signals are subscribed before sending, so the user can't be faster
+	var signals chan *dbus.Signal
+	if len(actions) > 0 {
+		match := []dbus.MatchOption{dbus.WithMatchObjectPath(notificationsPath), dbus.WithMatchInterface(notificationsIface)}
+		if err := conn.AddMatchSignal(match...); err != nil {
+			return "", fmt.Errorf("failed to subscribe to notification signals: %w", err)
+		}
+		defer conn.RemoveMatchSignal(match...)
+
+		signals = make(chan *dbus.Signal, 8)
+		conn.Signal(signals)
+		defer conn.RemoveSignal(signals)
+	}
+
+	hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(byte(notification.Urgency))}
+	var id uint32
+	err = obj.Call(notificationsIface+".Notify", 0,
+		appName, uint32(0), appIcon, notification.Summary, body, actions, hints, int32(notification.Timeout.Milliseconds()),
+	).Store(&id)
+	if err != nil {
+		return "", fmt.Errorf("failed to send notification: %w", err)
+	}
+	slog.Debug("Notification sent", "id", id, "summary", notification.Summary)
+
+	if len(actions) == 0 {
+		return "", nil
+	}
+
+	timeout := time.After(notification.Timeout)
+	for {
+		select {
+		case signal := <-signals:
+			if len(signal.Body) < 2 || signal.Body[0] != id {
+				continue
+			}
+
+			switch signal.Name {
+			case notificationsIface + ".ActionInvoked":
+				key, _ := signal.Body[1].(string)
+				obj.Call(notificationsIface+".CloseNotification", 0, id)
+				return key, nil
+			case notificationsIface + ".NotificationClosed":
+				return "", nil
+			}
+		case <-timeout:
+			obj.Call(notificationsIface+".CloseNotification", 0, id)
+			return "", nil
+		}
+	}
+}
+
+var _ notify.Notifier = &Notifier{}
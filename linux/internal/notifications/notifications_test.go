@@ -0,0 +1,204 @@
+package notifications
+
+import (
+	"bufio"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/pltanton/autobrowser/common/pkg/notify"
+)
+
+// startSessionBus starts a private dbus-daemon and returns its address
+func startSessionBus(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	address := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address", "--address="+address)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	// The address is printed once the bus is ready
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read dbus-daemon address: %v", err)
+	}
+
+	return strings.TrimSpace(line)
+}
+
+// fakeServer implements the notification server, it invokes the configured
+// action of every notification with actions
+type fakeServer struct {
+	conn         *dbus.Conn
+	capabilities []string
+	action       string
+
+	// Methods are called from dbus worker goroutines
+	mu      sync.Mutex
+	body    string
+	actions []string
+	urgency byte
+	closed  []uint32
+}
+
+func (s *fakeServer) GetCapabilities() ([]string, *dbus.Error) {
+	return s.capabilities, nil
+}
+
+func (s *fakeServer) Notify(appName string, replacesID uint32, icon, summary, body string, actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+	s.actions = actions
+	s.urgency, _ = hints["urgency"].Value().(byte)
+
+	const id = 42
+	if len(actions) > 0 && s.action != "" {
+		go s.conn.Emit(notificationsPath, notificationsIface+".ActionInvoked", uint32(id), s.action)
+	}
+	return id, nil
+}
+
+func (s *fakeServer) CloseNotification(id uint32) *dbus.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = append(s.closed, id)
+	return nil
+}
+
+func startFakeServer(t *testing.T, address string, capabilities []string, action string) *fakeServer {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("failed to connect to bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &fakeServer{conn: conn, capabilities: capabilities, action: action}
+	if err := conn.Export(s, notificationsPath, notificationsIface); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply, err := conn.RequestName(notificationsService, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to request %s name: %v", notificationsService, err)
+	}
+
+	return s
+}
+
+func TestNotifier(t *testing.T) {
+	notification := notify.Notification{
+		Summary: "Opened in Work",
+		Body:    "https://example.com/?a=1&b=2",
+		Urgency: notify.UrgencyLow,
+		Actions: []notify.Action{{Key: "open-default", Label: "Open in Personal instead"}},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name         string
+		capabilities []string
+		action       string
+		want         string
+		wantBody     string
+		wantActions  int
+		wantClosed   int
+	}{
+		{
+			name:         "action invoked",
+			capabilities: []string{"actions", "body"},
+			action:       "open-default",
+			want:         "open-default",
+			wantBody:     notification.Body,
+			wantActions:  2,
+			wantClosed:   1,
+		},
+		{
+			name:         "timed out",
+			capabilities: []string{"actions", "body", "body-markup"},
+			wantBody:     "https://example.com/?a=1&amp;b=2",
+			wantActions:  2,
+			wantClosed:   1,
+		},
+		{
+			name:         "no actions support",
+			capabilities: []string{"body"},
+			action:       "open-default",
+			wantBody:     notification.Body,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := startSessionBus(t)
+			server := startFakeServer(t, address, tt.capabilities, tt.action)
+
+			conn, err := dbus.Connect(address)
+			if err != nil {
+				t.Fatalf("failed to connect to bus: %v", err)
+			}
+			t.Cleanup(func() { conn.Close() })
+
+			n := &Notifier{connect: func() (*dbus.Conn, error) { return conn, nil }}
+			got, err := n.Notify(notification)
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Notify() = %q, want %q", got, tt.want)
+			}
+			if !conn.Connected() {
+				t.Error("Notify() closed the shared connection")
+			}
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if server.body != tt.wantBody {
+				t.Errorf("body = %q, want %q", server.body, tt.wantBody)
+			}
+			if len(server.actions) != tt.wantActions {
+				t.Errorf("actions = %q, want %d", server.actions, tt.wantActions)
+			}
+			if server.urgency != byte(notify.UrgencyLow) {
+				t.Errorf("urgency = %d, want %d", server.urgency, notify.UrgencyLow)
+			}
+			if len(server.closed) != tt.wantClosed {
+				t.Errorf("closed = %v, want %d notifications", server.closed, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestNotifierNoServer(t *testing.T) {
+	address := startSessionBus(t)
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("failed to connect to bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	n := &Notifier{connect: func() (*dbus.Conn, error) { return conn, nil }}
+	if _, err := n.Notify(notify.Notification{Summary: "test"}); err == nil {
+		t.Error("Notify() did not return error without notification server")
+	}
+}
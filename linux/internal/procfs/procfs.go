@@ -0,0 +1,183 @@
+// Package procfs reads process details from /proc
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// root is overridden in tests
+var root = "/proc"
+
+// Process describes the process owning the window
+type Process struct {
+	Exe     string
+	Cmdline []string
+	Cwd     string
+	// Cgroup is the path in the unified (v2) or systemd hierarchy
+	Cgroup string
+	// Unit is the innermost systemd service or scope of the cgroup
+	Unit string
+
+	FlatpakID string
+	SnapName  string
+}
+
+// Read reads process details, details not readable because of permissions
+// are left empty
+func Read(pid int) (Process, error) {
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	if _, err := os.Stat(dir); err != nil {
+		return Process{}, fmt.Errorf("failed to read process %d: %w", pid, err)
+	}
+
+	var p Process
+	p.Exe, _ = os.Readlink(filepath.Join(dir, "exe"))
+	p.Cwd, _ = os.Readlink(filepath.Join(dir, "cwd"))
+
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		if trimmed := strings.TrimRight(string(cmdline), "\x00"); trimmed != "" {
+			p.Cmdline = strings.Split(trimmed, "\x00")
+		}
+	}
+
+	if cgroup, err := readCgroup(filepath.Join(dir, "cgroup")); err == nil {
+		p.Cgroup = cgroup
+		p.Unit = cgroupUnit(cgroup)
+	}
+
+	p.FlatpakID = flatpakID(dir, p.Unit)
+	p.SnapName = snapName(p.Exe, p.Unit)
+
+	return p, nil
+}
+
+// flatpakID reads the app ID from .flatpak-info in the sandbox root, or
+// parses it from app-flatpak-<id>-<n>.scope unit when the root is not
+// accessible
+func flatpakID(dir string, unit string) string {
+	if info, err := os.ReadFile(filepath.Join(dir, "root", ".flatpak-info")); err == nil {
+		if id := parseFlatpakInfo(string(info)); id != "" {
+			return id
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(unit, "app-flatpak-"); ok {
+		if rest, ok = strings.CutSuffix(rest, ".scope"); ok {
+			if i := strings.LastIndex(rest, "-"); i > 0 {
+				return rest[:i]
+			}
+		}
+	}
+
+	return ""
+}
+
+// parseFlatpakInfo returns name key of [Application] group
+func parseFlatpakInfo(info string) string {
+	var group string
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = line[1 : len(line)-1]
+			continue
+		}
+
+		if key, value, ok := strings.Cut(line, "="); ok && group == "Application" && strings.TrimSpace(key) == "name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// snapName parses snap.<name>.<app>... unit, or the executable path in
+// /snap/<name>/<revision>/
+func snapName(exe, unit string) string {
+	if rest, ok := strings.CutPrefix(unit, "snap."); ok {
+		if name, _, ok := strings.Cut(rest, "."); ok {
+			return name
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(exe, "/snap/"); ok {
+		if name, _, ok := strings.Cut(rest, "/"); ok {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// readCgroup returns the unified hierarchy path, or the systemd one on
+// legacy cgroup v1 systems
+func readCgroup(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var systemd string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines are in hierarchy-ID:controllers:path format
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			return parts[2], nil
+		case parts[1] == "name=systemd":
+			systemd = parts[2]
+		}
+	}
+
+	return systemd, scanner.Err()
+}
+
+// cgroupUnit returns the last service or scope of the cgroup path, e.g.
+// app-firefox-1234.scope for
+// /user.slice/user-1000.slice/user@1000.service/app.slice/app-firefox-1234.scope
+func cgroupUnit(cgroup string) string {
+	parts := strings.Split(cgroup, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if strings.HasSuffix(parts[i], ".service") || strings.HasSuffix(parts[i], ".scope") {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+// Stat returns command name and parent PID of the process
+func Stat(pid int) (string, int, error) {
+	stat, err := os.ReadFile(filepath.Join(root, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read process %d stat: %w", pid, err)
+	}
+
+	// Format is "pid (comm) state ppid ...", comm may contain spaces and
+	// parentheses, so the last one closes it
+	start, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return "", 0, fmt.Errorf("invalid process %d stat", pid)
+	}
+
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 2 {
+		return "", 0, fmt.Errorf("invalid process %d stat", pid)
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid process %d parent: %w", pid, err)
+	}
+
+	return string(stat[start+1 : end]), ppid, nil
+}
@@ -0,0 +1,169 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeProc creates /proc/<pid> entries in a temporary directory
+func fakeProc(t *testing.T, pid string, exe, cwd, cmdline, cgroup string) {
+	t.Helper()
+
+	dir := filepath.Join(root, pid)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if exe != "" {
+		if err := os.Symlink(exe, filepath.Join(dir, "exe")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cwd != "" {
+		if err := os.Symlink(cwd, filepath.Join(dir, "cwd")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{"cmdline": cmdline, "cgroup": cgroup} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadProcess(t *testing.T) {
+	oldRoot := root
+	root = t.TempDir()
+	t.Cleanup(func() { root = oldRoot })
+
+	fakeProc(t, "100", "/usr/lib/slack/slack", "/home/user",
+		"/usr/lib/slack/slack\x00--enable-features=UseOzonePlatform\x00",
+		"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-slack-1234.scope\n")
+	fakeProc(t, "200", "/usr/bin/firefox", "", "firefox\x00",
+		"12:pids:/user.slice\n1:name=systemd:/user.slice/user-1000.slice/session-2.scope\n0::/\n")
+	fakeProc(t, "300", "/usr/bin/foot", "", "",
+		"1:name=systemd:/user.slice/user-1000.slice/user@1000.service/app.slice/foot-server.service\n")
+	// Kernel threads and processes of other users have no readable links
+	fakeProc(t, "400", "", "", "", "")
+	fakeProc(t, "500", "/app/bin/signal-desktop", "", "", "0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-flatpak-org.signal.Signal-7125.scope\n")
+	fakeProc(t, "600", "/app/bin/telegram", "", "", "0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-gnome-telegram-42.scope\n")
+	if err := os.MkdirAll(filepath.Join(root, "600", "root"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	info := "[Application]\nname=org.telegram.desktop\nruntime=runtime/org.kde.Platform/x86_64/6.7\n\n[Instance]\nname=other\n"
+	if err := os.WriteFile(filepath.Join(root, "600", "root", ".flatpak-info"), []byte(info), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fakeProc(t, "700", "/snap/firefox/4793/usr/lib/firefox/firefox", "", "", "0::/user.slice/user-1000.slice/user@1000.service/app.slice/snap.firefox.firefox-2f6e7a4c.scope\n")
+	fakeProc(t, "800", "/snap/spotify/80/usr/share/spotify/spotify", "", "", "0::/\n")
+
+	tests := []struct {
+		pid     int
+		want    Process
+		wantErr bool
+	}{
+		{100, Process{
+			Exe:     "/usr/lib/slack/slack",
+			Cmdline: []string{"/usr/lib/slack/slack", "--enable-features=UseOzonePlatform"},
+			Cwd:     "/home/user",
+			Cgroup:  "/user.slice/user-1000.slice/user@1000.service/app.slice/app-slack-1234.scope",
+			Unit:    "app-slack-1234.scope",
+		}, false},
+		{200, Process{Exe: "/usr/bin/firefox", Cmdline: []string{"firefox"}, Cgroup: "/"}, false},
+		{300, Process{
+			Exe:    "/usr/bin/foot",
+			Cgroup: "/user.slice/user-1000.slice/user@1000.service/app.slice/foot-server.service",
+			Unit:   "foot-server.service",
+		}, false},
+		{400, Process{}, false},
+		{500, Process{
+			Exe:       "/app/bin/signal-desktop",
+			Cgroup:    "/user.slice/user-1000.slice/user@1000.service/app.slice/app-flatpak-org.signal.Signal-7125.scope",
+			Unit:      "app-flatpak-org.signal.Signal-7125.scope",
+			FlatpakID: "org.signal.Signal",
+		}, false},
+		{600, Process{
+			Exe:       "/app/bin/telegram",
+			Cgroup:    "/user.slice/user-1000.slice/user@1000.service/app.slice/app-gnome-telegram-42.scope",
+			Unit:      "app-gnome-telegram-42.scope",
+			FlatpakID: "org.telegram.desktop",
+		}, false},
+		{700, Process{
+			Exe:      "/snap/firefox/4793/usr/lib/firefox/firefox",
+			Cgroup:   "/user.slice/user-1000.slice/user@1000.service/app.slice/snap.firefox.firefox-2f6e7a4c.scope",
+			Unit:     "snap.firefox.firefox-2f6e7a4c.scope",
+			SnapName: "firefox",
+		}, false},
+		{800, Process{Exe: "/snap/spotify/80/usr/share/spotify/spotify", Cgroup: "/", SnapName: "spotify"}, false},
+		{900, Process{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := Read(tt.pid)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Read(%d) error = %v, wantErr %v", tt.pid, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Read(%d) = %+v, want %+v", tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestReadOwnProcess(t *testing.T) {
+	got, err := Read(os.Getpid())
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Exe != exe {
+		t.Errorf("Exe = %q, want %q", got.Exe, exe)
+	}
+	if len(got.Cmdline) == 0 || got.Cmdline[0] != os.Args[0] {
+		t.Errorf("Cmdline = %q, want %q first", got.Cmdline, os.Args[0])
+	}
+}
+
+func TestStat(t *testing.T) {
+	oldRoot := root
+	root = t.TempDir()
+	t.Cleanup(func() { root = oldRoot })
+
+	stats := map[string]string{
+		"100": "100 (bash) S 42 100 100 0 -1 4194304",
+		"200": "200 (my (weird) name) S 100 200 100 0 -1",
+		"300": "300 (broken",
+	}
+	for pid, stat := range stats {
+		if err := os.MkdirAll(filepath.Join(root, pid), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, pid, "stat"), []byte(stat), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pid     int
+		comm    string
+		ppid    int
+		wantErr bool
+	}{
+		{100, "bash", 42, false},
+		{200, "my (weird) name", 100, false},
+		{300, "", 0, true},
+		{400, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		comm, ppid, err := Stat(tt.pid)
+		if (err != nil) != tt.wantErr || comm != tt.comm || ppid != tt.ppid {
+			t.Errorf("Stat(%d) = %q, %d, %v, want %q, %d, wantErr %v", tt.pid, comm, ppid, err, tt.comm, tt.ppid, tt.wantErr)
+		}
+	}
+}
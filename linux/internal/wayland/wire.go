@@ -0,0 +1,208 @@
+// Package wayland implements the Wayland wire format, just enough to talk
+// simple protocols without file descriptor passing.
+package wayland
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const headerSize = 8
+
+// DisplayID is the object ID of wl_display singleton
+const DisplayID uint32 = 1
+
+// Message is a request or event, Args are encoded arguments
+type Message struct {
+	Object uint32
+	Opcode uint16
+	Args   []byte
+}
+
+// Conn sends and receives messages over the Wayland socket
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// SocketPath returns the compositor socket path from WAYLAND_DISPLAY and
+// XDG_RUNTIME_DIR
+func SocketPath() (string, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		display = "wayland-0"
+	}
+	if filepath.IsAbs(display) {
+		return display, nil
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return "", errors.New("XDG_RUNTIME_DIR is not set")
+	}
+
+	return filepath.Join(runtimeDir, display), nil
+}
+
+// Dial connects to the compositor found by SocketPath
+func Dial(timeout time.Duration) (*Conn, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to wayland compositor: %w", err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return NewConn(conn), nil
+}
+
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// SetDeadline sets the read and write deadline of the connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// Send encodes and sends the message, supported argument types are uint32,
+// int32, string and []byte for arrays
+func (c *Conn) Send(object uint32, opcode uint16, args ...any) error {
+	var payload []byte
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			payload = binary.NativeEndian.AppendUint32(payload, v)
+		case int32:
+			payload = binary.NativeEndian.AppendUint32(payload, uint32(v))
+		case string:
+			// Strings are null terminated and the length includes terminator
+			payload = appendArray(payload, append([]byte(v), 0))
+		case []byte:
+			payload = appendArray(payload, v)
+		default:
+			return fmt.Errorf("unsupported argument type %T", arg)
+		}
+	}
+
+	size := headerSize + len(payload)
+	if size > 0xffff {
+		return fmt.Errorf("message is too long: %d bytes", size)
+	}
+
+	msg := binary.NativeEndian.AppendUint32(make([]byte, 0, size), object)
+	msg = binary.NativeEndian.AppendUint32(msg, uint32(size)<<16|uint32(opcode))
+	msg = append(msg, payload...)
+
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+// Receive reads the next message
+func (c *Conn) Receive() (Message, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return Message{}, err
+	}
+
+	sizeOpcode := binary.NativeEndian.Uint32(header[4:])
+	size := int(sizeOpcode >> 16)
+	if size < headerSize {
+		return Message{}, fmt.Errorf("invalid message size %d", size)
+	}
+
+	msg := Message{
+		Object: binary.NativeEndian.Uint32(header),
+		Opcode: uint16(sizeOpcode),
+		Args:   make([]byte, size-headerSize),
+	}
+	if _, err := io.ReadFull(c.r, msg.Args); err != nil {
+		return Message{}, err
+	}
+
+	return msg, nil
+}
+
+func appendArray(payload []byte, data []byte) []byte {
+	payload = binary.NativeEndian.AppendUint32(payload, uint32(len(data)))
+	payload = append(payload, data...)
+	for len(payload)%4 != 0 {
+		payload = append(payload, 0)
+	}
+	return payload
+}
+
+// ArgReader decodes message arguments in order, the first decoding error is
+// kept in Err and zero values are returned after it
+type ArgReader struct {
+	data []byte
+	Err  error
+}
+
+func (m Message) Reader() *ArgReader {
+	return &ArgReader{data: m.Args}
+}
+
+func (r *ArgReader) ReadUint() uint32 {
+	if r.Err != nil {
+		return 0
+	}
+	if len(r.data) < 4 {
+		r.Err = errors.New("message is too short")
+		return 0
+	}
+
+	v := binary.NativeEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *ArgReader) ReadInt() int32 {
+	return int32(r.ReadUint())
+}
+
+func (r *ArgReader) ReadArray() []byte {
+	size := int(r.ReadUint())
+	if r.Err != nil {
+		return nil
+	}
+
+	padded := (size + 3) &^ 3
+	if len(r.data) < padded {
+		r.Err = errors.New("message is too short")
+		return nil
+	}
+
+	v := r.data[:size]
+	r.data = r.data[padded:]
+	return v
+}
+
+func (r *ArgReader) ReadString() string {
+	v := r.ReadArray()
+	if len(v) == 0 {
+		return ""
+	}
+	return string(v[:len(v)-1])
+}
@@ -0,0 +1,80 @@
+package wayland
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestSendReceive(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		c := NewConn(client)
+		c.Send(3, 7, uint32(42), int32(-1), "abc", []byte{1, 2, 3, 4, 5}, "")
+	}()
+
+	msg, err := NewConn(server).Receive()
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+
+	if msg.Object != 3 || msg.Opcode != 7 {
+		t.Errorf("Receive() object, opcode = %d, %d, want 3, 7", msg.Object, msg.Opcode)
+	}
+	// 4 + 4 + (4 + 4) + (4 + 8) + (4 + 4) bytes of arguments
+	if len(msg.Args) != 36 {
+		t.Errorf("len(Args) = %d, want 36", len(msg.Args))
+	}
+
+	r := msg.Reader()
+	if v := r.ReadUint(); v != 42 {
+		t.Errorf("ReadUint() = %d, want 42", v)
+	}
+	if v := r.ReadInt(); v != -1 {
+		t.Errorf("ReadInt() = %d, want -1", v)
+	}
+	if v := r.ReadString(); v != "abc" {
+		t.Errorf("ReadString() = %q, want abc", v)
+	}
+	if v := r.ReadArray(); !bytes.Equal(v, []byte{1, 2, 3, 4, 5}) {
+		t.Errorf("ReadArray() = %v, want [1 2 3 4 5]", v)
+	}
+	if v := r.ReadString(); v != "" {
+		t.Errorf("ReadString() = %q, want empty", v)
+	}
+	if r.Err != nil {
+		t.Errorf("Err = %v", r.Err)
+	}
+
+	r.ReadUint()
+	if r.Err == nil {
+		t.Errorf("reading past the end did not set Err")
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	tests := []struct {
+		display    string
+		runtimeDir string
+		want       string
+		wantErr    bool
+	}{
+		{"wayland-1", "/run/user/1000", "/run/user/1000/wayland-1", false},
+		{"", "/run/user/1000", "/run/user/1000/wayland-0", false},
+		{"/tmp/wayland-2", "", "/tmp/wayland-2", false},
+		{"wayland-1", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("WAYLAND_DISPLAY", tt.display)
+		t.Setenv("XDG_RUNTIME_DIR", tt.runtimeDir)
+
+		got, err := SocketPath()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("SocketPath() with %q, %q = %q, %v, want %q", tt.display, tt.runtimeDir, got, err, tt.want)
+		}
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"log/slog"
 	"os"
 	"os/user"
+	"path/filepath"
 	"time"
 
 	"github.com/pltanton/autobrowser/common/pkg/app"
 	"github.com/pltanton/autobrowser/common/pkg/matchers"
+	"github.com/pltanton/autobrowser/common/pkg/matchers/domainlistmatcher"
 	"github.com/pltanton/autobrowser/common/pkg/matchers/urlmatcher"
 	"github.com/pltanton/autobrowser/macos/internal/macevents"
 	"github.com/pltanton/autobrowser/macos/internal/matchers/appmatcher"
@@ -52,8 +54,10 @@ func main() {
 
 	registry := matchers.NewMatcherRegistry()
 
-	registry.RegisterMatcher("url", urlmatcher.New(urlEvent.URL))
+	registry.RegisterMatcher("url", urlmatcher.New())
+	registry.RegisterMatcher("domain_list", domainlistmatcher.New(filepath.Dir(cfg)))
 	registry.RegisterMatcher("app", appmatcher.New(urlEvent.PID))
 
-	app.SetupAndRun(cfg, urlEvent.URL, registry)
+	// Desktop notifications are sent over D-Bus, which is not available on macOS
+	app.SetupAndRun(cfg, urlEvent.URL, registry, nil)
 }
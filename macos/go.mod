@@ -6,6 +6,9 @@ toolchain go1.24.4
 
 require github.com/pltanton/autobrowser/common v0.0.0
 
-require github.com/BurntSushi/toml v1.5.0 // indirect
+require (
+	github.com/BurntSushi/toml v1.5.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+)
 
 replace github.com/pltanton/autobrowser/common => ../common
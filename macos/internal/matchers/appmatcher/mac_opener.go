@@ -7,10 +7,17 @@ import (
 	"github.com/pltanton/autobrowser/macos/internal/macevents"
 )
 
+type macAppMatcherFactory struct {
+	sourceApp macevents.AppInfo
+}
+
 type macAppMatcher struct {
 	sourceApp macevents.AppInfo
+	config    macAppMatcherConfig
 }
 
+var _ matchers.Factory = &macAppMatcherFactory{}
+var _ matchers.FieldProvider = &macAppMatcherFactory{}
 var _ matchers.Matcher = &macAppMatcher{}
 
 type macAppMatcherConfig struct {
@@ -20,13 +27,43 @@ type macAppMatcherConfig struct {
 	ExecutablePath string `toml:"executable_path,omitempty"`
 }
 
-// Match implements matchers.Matcher.
-func (h *macAppMatcher) Match(configProvider matchers.MatcherConfigProvider) (bool, error) {
+// Compile implements matchers.Factory.
+func (f *macAppMatcherFactory) Compile(configProvider matchers.MatcherConfigProvider) (matchers.Matcher, error) {
 	var c macAppMatcherConfig
 	if err := configProvider(&c); err != nil {
-		return false, fmt.Errorf("failed to load mac app matcher config: %w", err)
+		return nil, fmt.Errorf("failed to load mac app matcher config: %w", err)
 	}
 
+	return &macAppMatcher{
+		sourceApp: f.sourceApp,
+		config:    c,
+	}, nil
+}
+
+// Field implements matchers.FieldProvider.
+func (f *macAppMatcherFactory) Field(name string) (string, bool) {
+	switch name {
+	case "display_name":
+		return f.sourceApp.LocalizedName, true
+	case "bundle_id":
+		return f.sourceApp.BundleID, true
+	case "bundle_path":
+		return f.sourceApp.BundleURL, true
+	case "executable_path":
+		return f.sourceApp.ExecutableURL, true
+	}
+	return "", false
+}
+
+// FieldNames implements matchers.FieldProvider.
+func (f *macAppMatcherFactory) FieldNames() []string {
+	return []string{"display_name", "bundle_id", "bundle_path", "executable_path"}
+}
+
+// Match implements matchers.Matcher.
+func (h *macAppMatcher) Match(*matchers.Request) (bool, error) {
+	c := h.config
+
 	if c.DisplayName != "" && h.sourceApp.LocalizedName != c.DisplayName {
 		return false, nil
 	}
@@ -43,8 +80,8 @@ func (h *macAppMatcher) Match(configProvider matchers.MatcherConfigProvider) (bo
 	return true, nil
 }
 
-func New(ppid int) matchers.Matcher {
-	return &macAppMatcher{
+func New(ppid int) matchers.Factory {
+	return &macAppMatcherFactory{
 		sourceApp: macevents.GetRunningAppInfo(ppid),
 	}
 }
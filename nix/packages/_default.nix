@@ -8,8 +8,8 @@ buildGoModule {
   version = "1.0.4";
   vendorHash =
     if stdenv.isDarwin
-    then "sha256-/8llw+85SbNKxlAfwZBJmHNYZunCZeXiMmoGzZ4eMYs="
-    else "sha256-05D0rsPh/QLCL5i5c/xNTBozdRkPmtRQa5KU/Y0Y4pA=";
+    then "sha256-GXIlHkpobJeK1aOdUr7ZCelADaX8gGsFMIapDOJG088="
+    else "sha256-TIm/pAMbGARVWtmbgwRnsL4kNl1IxRCJCj2gWvB1Nk8=";
 
   src = import ../src.nix {inherit lib;};
   modRoot =
@@ -6,7 +6,7 @@
 buildGoModule {
   pname = "autobrowser-common";
   version = "0";
-  vendorHash = "sha256-CVycV7wxo7nOHm7qjZKfJrIkNcIApUNzN1mSIIwQN0g=";
+  vendorHash = "sha256-ZrFvR5XE4IrggXhWawftRxnXACsfko81LLkPNVwTf0c=";
   src = import ../src.nix {inherit lib;};
 
   modRoot = "common";